@@ -0,0 +1,171 @@
+package crawl
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/publicsuffix"
+)
+
+// httpOnlyPrefix marks HttpOnly cookies in Netscape cookies files, which would otherwise be comments
+const httpOnlyPrefix = "#HttpOnly_"
+
+// authenticate sets up the authentication of requests from the configuration : the cookie jar, cookies imported from
+// a file, basic or bearer authorization, and the login step. Values already set by options are kept.
+func authenticate(conf *config, p *parameters) error {
+	if p.client.Jar == nil && (conf.Auth.Cookies || conf.Auth.CookiesFile != "" || conf.Auth.LoginURL != "") {
+		jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		if err != nil {
+			return errors.Wrap(err, "Could not create cookie jar")
+		}
+		p.client.Jar = jar
+	}
+
+	if conf.Auth.CookiesFile != "" {
+		if err := importCookies(p.client.Jar, conf.Auth.CookiesFile); err != nil {
+			return err
+		}
+	}
+
+	if p.headers.common.Get("Authorization") == "" {
+		switch {
+		case conf.Auth.Username != "":
+			p.headers.set("Authorization", basicAuth(conf.Auth.Username, conf.Auth.Password))
+		case conf.Auth.Token != "":
+			p.headers.set("Authorization", "Bearer "+conf.Auth.Token)
+		}
+	}
+
+	if conf.Auth.LoginURL != "" {
+		return login(p, conf.Auth.LoginURL, conf.Auth.LoginForm)
+	}
+
+	return nil
+}
+
+// basicAuth returns the Authorization header value for HTTP Basic authentication
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// redact returns the url without its user information, so it can be logged
+func redact(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "<invalid url>"
+	}
+	u.User = nil
+	return u.String()
+}
+
+// login POSTs the url encoded form to loginURL, so that the session cookies it sets are stored in the cookie jar.
+// Errors and logs never contain the form.
+func login(p *parameters, loginURL, form string) error {
+	if p.client.Jar == nil {
+		return errors.New("Login needs a cookie jar to keep the session")
+	}
+
+	if _, err := url.ParseQuery(form); err != nil {
+		return errors.Errorf("Invalid login form for %s, expected url encoded values", redact(loginURL))
+	}
+
+	req, err := http.NewRequest("POST", loginURL, strings.NewReader(form))
+	if err != nil {
+		return errors.Errorf("Could not make a login request for %s", redact(loginURL))
+	}
+	req.Header = p.headers.forHost(req.URL.Hostname())
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(context.WithValue(context.Background(), redirectKey{},
+		&redirectTracker{max: p.maxRedirects, headers: p.headers}))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		// The http.Client's errors don't contain the url's password
+		return errors.Wrapf(err, "Login request to %s failed", redact(loginURL))
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.Errorf("Login to %s failed with status %d", redact(loginURL), resp.StatusCode)
+	}
+
+	log.WithField("url", redact(loginURL)).Info("Logged in.")
+	return nil
+}
+
+// importCookies loads the cookies of a Netscape cookies.txt file into the jar
+func importCookies(jar http.CookieJar, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.Wrapf(err, "Could not open cookies file")
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		u, cookie, err := parseCookieLine(scanner.Text())
+		if err != nil {
+			return errors.Wrapf(err, "Invalid cookie in %s at line %d", file, n)
+		}
+		if cookie != nil {
+			jar.SetCookies(u, []*http.Cookie{cookie})
+		}
+	}
+
+	return errors.Wrapf(scanner.Err(), "Could not read cookies file %s", file)
+}
+
+// parseCookieLine returns the cookie of a line of a Netscape cookies file and the url it was set for.
+// Comments and blank lines return a nil cookie.
+func parseCookieLine(line string) (*url.URL, *http.Cookie, error) {
+	httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+	line = strings.TrimPrefix(line, httpOnlyPrefix)
+	if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+		return nil, nil, nil
+	}
+
+	// domain, include subdomains, path, secure, expiry, name, value
+	fields := strings.Split(line, "\t")
+	if len(fields) != 7 {
+		return nil, nil, errors.Errorf("expected 7 tab separated fields, got %d", len(fields))
+	}
+
+	expiry, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return nil, nil, errors.New("invalid expiry date")
+	}
+
+	host := strings.TrimPrefix(fields[0], ".")
+	secure := strings.EqualFold(fields[3], "TRUE")
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+
+	cookie := &http.Cookie{
+		Name:     fields[5],
+		Value:    fields[6],
+		Path:     fields[2],
+		Secure:   secure,
+		HttpOnly: httpOnly,
+	}
+	if strings.EqualFold(fields[1], "TRUE") {
+		cookie.Domain = host
+	}
+	if expiry != 0 {
+		cookie.Expires = time.Unix(expiry, 0)
+	}
+
+	return &url.URL{Scheme: scheme, Host: host, Path: fields[2]}, cookie, nil
+}
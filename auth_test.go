@@ -0,0 +1,196 @@
+package crawl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testUser     = "crawler"
+	testPassword = "s3cr3t-p4ss"
+	testToken    = "t0k3n"
+)
+
+// newAuthServer returns a test server that only serves /page to authenticated clients : with the session cookie
+// given by /login, the "imported" cookie, basic authentication or the bearer token.
+func newAuthServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.PostFormValue("user") != testUser || r.PostFormValue("pass") != testPassword {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "logged-in", Path: "/"})
+		http.Redirect(w, r, "/page", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, basic := r.BasicAuth()
+		session, _ := r.Cookie("session")
+		imported, _ := r.Cookie("imported")
+		switch {
+		case session != nil && session.Value == "logged-in",
+			imported != nil && imported.Value == "yes",
+			basic && user == testUser && pass == testPassword,
+			r.Header.Get("Authorization") == "Bearer "+testToken:
+			_, _ = fmt.Fprint(w, `<a href="/private">private</a>`)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+// checkAuthenticated verifies the protected page is accessible with the parameters set by conf and options
+func checkAuthenticated(t *testing.T, server *httptest.Server, method string, conf *config, options ...Option) {
+	params, err := newParameters(conf, 3*time.Second, options...)
+	if err != nil {
+		t.Errorf("authentication with %s failed : %s", method, err)
+		return
+	}
+
+	res, err := cancellableScrap(context.Background(), server.URL+"/page", params)
+	if err != nil || res.Status != http.StatusOK {
+		t.Errorf("authentication with %s failed : %v, %v", method, res, err)
+	}
+}
+
+// TestAuthenticate verifies the different authentication methods
+func TestAuthenticate(t *testing.T) {
+	server := newAuthServer()
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	host = host[:strings.Index(host, ":")]
+
+	conf := getTestConfig()
+	conf.Auth.Username, conf.Auth.Password = testUser, testPassword
+	checkAuthenticated(t, server, "basic authentication", conf)
+
+	conf = getTestConfig()
+	conf.Auth.Token = testToken
+	checkAuthenticated(t, server, "bearer token", conf)
+
+	checkAuthenticated(t, server, "basic authentication option", getTestConfig(), WithBasicAuth(testUser, testPassword))
+
+	conf = getTestConfig()
+	conf.Auth.LoginURL = server.URL + "/login"
+	conf.Auth.LoginForm = "user=" + testUser + "&pass=" + testPassword
+	checkAuthenticated(t, server, "login", conf)
+
+	file, err := ioutil.TempFile("", "cookies-*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+	_, _ = fmt.Fprintf(file, "# Netscape HTTP Cookie File\n\n%s\tFALSE\t/\tFALSE\t0\timported\tyes\n", host)
+	_ = file.Close()
+
+	conf = getTestConfig()
+	conf.Auth.CookiesFile = file.Name()
+	checkAuthenticated(t, server, "imported cookies", conf)
+
+	// Without authentication
+	res, err := cancellableScrap(context.Background(), server.URL+"/page", getTestParameters(3*time.Second))
+	if err != nil || res.Status != http.StatusUnauthorized {
+		t.Errorf("the protected page should not be accessible without authentication : %v, %v", res, err)
+	}
+}
+
+// TestCookieJarOption verifies the given cookie jar is kept whatever the order of options
+func TestCookieJarOption(t *testing.T) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, options := range [][]Option{
+		{WithCookieJar(jar)},
+		{WithCookieJar(jar), WithHTTPClient(&http.Client{})},
+		{WithHTTPClient(&http.Client{}), WithCookieJar(jar)},
+	} {
+		params, err := newParameters(getTestConfig(), time.Second, options...)
+		assert.NoError(t, err)
+		assert.Equal(t, jar, params.client.Jar)
+	}
+}
+
+// TestAuthenticateFail verifies failed logins and invalid cookie files, and that credentials are not logged
+func TestAuthenticateFail(t *testing.T) {
+	server := newAuthServer()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	out, level := log.Out, log.GetLevel()
+	log.SetOutput(&buf)
+	log.SetLevel(logrus.TraceLevel)
+	defer func() {
+		log.SetOutput(out)
+		log.SetLevel(level)
+	}()
+
+	conf := getTestConfig()
+	conf.Auth.LoginURL = strings.Replace(server.URL, "http://", "http://"+testUser+":"+testPassword+"@", 1) + "/login"
+	conf.Auth.LoginForm = "user=" + testUser + "&pass=wrong-" + testPassword
+	_, err := newParameters(conf, 3*time.Second)
+	if err == nil {
+		t.Error("newParameters() should fail when login fails.")
+	} else {
+		log.Error(err)
+	}
+
+	conf.Auth.LoginURL = "http://" + testUser + ":" + testPassword + "@127.0.0.1:1/login"
+	if _, err = newParameters(conf, 3*time.Second); err == nil {
+		t.Error("newParameters() should fail when the login request fails.")
+	} else {
+		log.Error(err)
+	}
+
+	if strings.Contains(buf.String(), testPassword) {
+		t.Errorf("credentials should never be logged :\n%s", buf.String())
+	}
+
+	for _, line := range []string{"example.com\tTRUE\t/\tFALSE\t0\tname", "example.com\tTRUE\t/\tFALSE\tnever\tname\tvalue"} {
+		if _, _, err := parseCookieLine(line); err == nil {
+			t.Errorf("parseCookieLine() should fail on '%s'.", line)
+		}
+	}
+
+	conf = getTestConfig()
+	conf.Auth.CookiesFile = "non-existent-cookies.txt"
+	if _, err = newParameters(conf, 3*time.Second); err == nil {
+		t.Error("newParameters() should fail when the cookies file can't be read.")
+	}
+}
+
+// TestParseCookieLine verifies the fields of Netscape cookies are read
+func TestParseCookieLine(t *testing.T) {
+	u, cookie, err := parseCookieLine("#HttpOnly_.example.com\tTRUE\t/docs\tTRUE\t1893456000\tid\tabc")
+	if err != nil {
+		t.Fatalf("parseCookieLine() should not fail : %s", err)
+	}
+	assert.Equal(t, "https://example.com/docs", u.String())
+	assert.Equal(t, "example.com", cookie.Domain)
+	assert.True(t, cookie.Secure)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, int64(1893456000), cookie.Expires.Unix())
+	assert.Equal(t, "abc", cookie.Value)
+
+	for _, line := range []string{"", "# comment"} {
+		if _, cookie, err := parseCookieLine(line); cookie != nil || err != nil {
+			t.Errorf("parseCookieLine() should ignore '%s'.", line)
+		}
+	}
+}
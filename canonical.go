@@ -0,0 +1,169 @@
+package crawl
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// CanonicalProblem tells what is wrong with the canonical link of a page
+type CanonicalProblem string
+
+// Problems found with canonical links
+const (
+	CanonicalBroken       CanonicalProblem = "broken"       // the canonical page is an error, or could not be retrieved
+	CanonicalOffHost      CanonicalProblem = "off-host"     // the canonical page is on another host
+	CanonicalChain        CanonicalProblem = "chain"        // the canonical page declares another canonical page
+	CanonicalInconsistent CanonicalProblem = "inconsistent" // the canonical is the page itself, written differently
+)
+
+// CanonicalIssue is a problem found with the canonical link of a page
+type CanonicalIssue struct {
+	URL       string
+	Canonical string
+	Problem   CanonicalProblem
+}
+
+// canonicalTracker records the canonical links and statuses of the pages of a crawl, to find problems with them
+type canonicalTracker struct {
+	canonicals map[string]string // canonical link of pages declaring one, by final URL
+	status     map[string]int    // status of pages by URL and final URL, 0 if they could not be retrieved
+	issues     []CanonicalIssue  // problems found from the page alone
+}
+
+// newCanonicalTracker returns an empty canonicalTracker
+func newCanonicalTracker() *canonicalTracker {
+	return &canonicalTracker{
+		canonicals: make(map[string]string),
+		status:     make(map[string]int),
+		issues:     nil,
+	}
+}
+
+// normalise returns link without its scheme, default port and trailing slash, with its host in lower case, for links
+// pointing to the same resource to be equal
+func normalise(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	u.Scheme, u.Host, u.Fragment = "", host, ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u.String()
+}
+
+// samePage returns whether a and b are the same URL, an empty path being the same as /
+func samePage(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	for _, u := range []*url.URL{ua, ub} {
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	}
+	return ua.String() == ub.String()
+}
+
+// add records the status and canonical link of a crawled page, and checks what can be from the page alone
+func (t *canonicalTracker) add(res *LinkMap) {
+	t.status[res.URL] = res.Status
+	page := res.URL
+	if res.FinalURL != "" {
+		t.status[res.FinalURL] = res.Status
+		page = res.FinalURL
+	}
+
+	if res.Canonical == "" || samePage(res.Canonical, page) {
+		return
+	}
+	t.canonicals[page] = res.Canonical
+
+	issue := CanonicalIssue{URL: page, Canonical: res.Canonical, Problem: ""}
+	switch pageURL, canonicalURL := normalise(page), normalise(res.Canonical); {
+	case pageURL == canonicalURL:
+		issue.Problem = CanonicalInconsistent
+	case hostOf(pageURL) != hostOf(canonicalURL):
+		issue.Problem = CanonicalOffHost
+	default:
+		return
+	}
+	t.issues = append(t.issues, issue)
+}
+
+// hostOf returns the host of link, or an empty string if it is invalid
+func hostOf(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// lookup returns the value of link in m, trying it without its query if it is not found as is, as links are visited
+// without them
+func lookup(m map[string]int, link string) (int, bool) {
+	if v, ok := m[link]; ok {
+		return v, true
+	}
+	if stripped, err := sanitise(link, link); err == nil && stripped != "" {
+		v, ok := m[stripped]
+		return v, ok
+	}
+	return 0, false
+}
+
+// report returns all problems found with the canonical links of the crawl, sorted by page. Canonical pages that were
+// not crawled can't be checked for errors.
+func (t *canonicalTracker) report() []CanonicalIssue {
+	issues := append([]CanonicalIssue{}, t.issues...)
+	for page, canonical := range t.canonicals {
+		if normalise(page) == normalise(canonical) {
+			continue
+		}
+		if status, ok := lookup(t.status, canonical); ok && (status == 0 || status >= 400) {
+			issues = append(issues, CanonicalIssue{URL: page, Canonical: canonical, Problem: CanonicalBroken})
+		}
+		if next, ok := t.canonicals[canonical]; ok && normalise(next) != normalise(canonical) {
+			issues = append(issues, CanonicalIssue{URL: page, Canonical: canonical, Problem: CanonicalChain})
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		if issues[i].URL != issues[j].URL {
+			return issues[i].URL < issues[j].URL
+		}
+		return issues[i].Problem < issues[j].Problem
+	})
+	return issues
+}
+
+// trackCanonical records the page's canonical link and status, if checking canonical links
+func (c *crawler) trackCanonical(result *LinkMap) {
+	if c.canonicals != nil {
+		c.canonicals.add(result)
+	}
+}
+
+// collapseCanonical replaces the links of result with its canonical page, if it is in scope, another page, and links
+// are deduplicated by canonical links : the canonical page is crawled instead of following the links of its variants
+func (c *crawler) collapseCanonical(result *LinkMap) {
+	if !c.dedupCanonical || result.Canonical == "" {
+		return
+	}
+	link, err := sanitise(result.Canonical, result.Canonical)
+	if err != nil || link == "" || !c.inScope(link) || link == result.URL || link == result.FinalURL {
+		return
+	}
+	log.WithField("url", result.URL).Tracef("Following canonical page %s instead of the links of the page.", link)
+	*result.Links = []string{link}
+}
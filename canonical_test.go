@@ -0,0 +1,93 @@
+package crawl
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCanonicalReport verifies problems with canonical links are found
+func TestCanonicalReport(t *testing.T) {
+	domain := "https://example.com"
+	tracker := newCanonicalTracker()
+	page := func(path string, status int, canonical string) {
+		res := newLinkMap(domain+path, nil)
+		res.FinalURL, res.Status, res.Canonical = domain+path, status, canonical
+		tracker.add(res)
+	}
+
+	page("", 200, domain+"/")
+	page("/a", 200, domain+"/b")
+	page("/b", 404, "")
+	page("/c", 200, "http://EXAMPLE.com:443/c/")
+	page("/d", 200, "https://other.com/d")
+	page("/e", 200, domain+"/f")
+	page("/f", 200, domain+"/g")
+	page("/h", 200, domain+"/b?lang=en")
+	page("/i", 200, domain+"/i")
+
+	assert.Equal(t, []CanonicalIssue{
+		{URL: domain + "/a", Canonical: domain + "/b", Problem: CanonicalBroken},
+		{URL: domain + "/c", Canonical: "http://EXAMPLE.com:443/c/", Problem: CanonicalInconsistent},
+		{URL: domain + "/d", Canonical: "https://other.com/d", Problem: CanonicalOffHost},
+		{URL: domain + "/e", Canonical: domain + "/f", Problem: CanonicalChain},
+		{URL: domain + "/h", Canonical: domain + "/b?lang=en", Problem: CanonicalBroken},
+	}, tracker.report())
+}
+
+// TestCrawlCanonical verifies canonical links are reported, and canonical pages followed instead of the links of their variants when deduplicating
+func TestCrawlCanonical(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = fmt.Fprint(w, `<a href="/variant">variant</a>`)
+		case "/variant":
+			_, _ = fmt.Fprint(w, `<link rel="canonical" href="/product"><a href="/product">product</a>`)
+		case "/product":
+			_, _ = fmt.Fprint(w, `<link rel="canonical" href="/gone">`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	syn := newSynchron(0, 1)
+	results := newCrawlerResults(syn)
+	go func() {
+		crawl(site.URL, syn, getTestConfig(), WithCanonical(false))
+		close(syn.results)
+	}()
+	pages := make(map[string]*LinkMap)
+	for res := range syn.results {
+		pages[res.URL] = res
+	}
+
+	assert.Len(t, pages, 3)
+	assert.Equal(t, site.URL+"/product", pages[site.URL+"/variant"].Canonical)
+	assert.Equal(t, []CanonicalIssue{
+		{URL: site.URL + "/variant", Canonical: site.URL + "/product", Problem: CanonicalChain},
+	}, results.CanonicalIssues())
+
+	// /variant only leads to /product, which is crawled, and so is its canonical page, found to be broken
+	syn = newSynchron(0, 1)
+	results = newCrawlerResults(syn)
+	go func() {
+		crawl(site.URL, syn, getTestConfig(), WithCanonical(true))
+		close(syn.results)
+	}()
+	pages = make(map[string]*LinkMap)
+	for res := range syn.results {
+		pages[res.URL] = res
+	}
+
+	assert.Len(t, pages, 4)
+	assert.Equal(t, []string{site.URL + "/product"}, *pages[site.URL+"/variant"].Links)
+	assert.Equal(t, 404, pages[site.URL+"/gone"].Status)
+	assert.Equal(t, []CanonicalIssue{
+		{URL: site.URL + "/product", Canonical: site.URL + "/gone", Problem: CanonicalBroken},
+		{URL: site.URL + "/variant", Canonical: site.URL + "/product", Problem: CanonicalChain},
+	}, results.CanonicalIssues())
+}
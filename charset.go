@@ -0,0 +1,77 @@
+package crawl
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/net/idna"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// charsetPeekSize is how much of a document is looked at to detect its encoding, as browsers do
+const charsetPeekSize = 1024
+
+// decodeBody returns body transcoded to UTF-8. The encoding is detected, in that order, from a byte order mark, the
+// charset of contentType, and a <meta charset> tag or its http-equiv equivalent in the first bytes of the body.
+// Bodies are taken to be windows-1252 if none are found and they are not valid UTF-8, which is what browsers do.
+func decodeBody(origin string, body io.Reader, contentType string) io.Reader {
+	buffered := bufio.NewReaderSize(body, charsetPeekSize)
+	start, _ := buffered.Peek(charsetPeekSize)
+
+	encoding, name, _ := charset.DetermineEncoding(start, contentType)
+	log.WithField("url", origin).Tracef("Reading body as %s.", name)
+	return transform.NewReader(buffered, unicode.BOMOverride(encoding.NewDecoder()))
+}
+
+// xmlCharsetReader returns input transcoded from the encoding named label to UTF-8, for encoding/xml decoders
+func xmlCharsetReader(label string, input io.Reader) (io.Reader, error) {
+	return charset.NewReaderLabel(label, input)
+}
+
+// normaliseURL makes links to the same resource equal, in place :
+// - internationalised host names are converted to their ASCII, punycode, form, in lower case
+// - percent-encoded unreserved characters of paths are decoded, and other escapes are in upper case
+func normaliseURL(u *url.URL) {
+	if host := u.Hostname(); host != "" {
+		if ascii, err := idna.Lookup.ToASCII(host); err == nil && ascii != host {
+			if port := u.Port(); port != "" {
+				ascii += ":" + port
+			}
+			u.Host = ascii
+		}
+	}
+
+	if u.RawPath != "" {
+		u.RawPath = normaliseEscapes(u.RawPath)
+	}
+}
+
+// normaliseEscapes returns the escaped path with its escaped unreserved characters decoded, and other escapes in upper
+// case
+func normaliseEscapes(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] != '%' || i+2 >= len(path) {
+			b.WriteByte(path[i])
+			continue
+		}
+		v, err := strconv.ParseUint(path[i+1:i+3], 16, 8)
+		if err != nil {
+			b.WriteByte(path[i])
+			continue
+		}
+		switch c := byte(v); {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		default:
+			b.WriteString(strings.ToUpper(path[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package crawl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// encode returns s in the given encoding
+func encode(t *testing.T, e encoding.Encoding, s string) []byte {
+	b, err := e.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestDecodeBody verifies bodies are transcoded from the encoding found in the header, a BOM or a meta tag
+func TestDecodeBody(t *testing.T) {
+	page := func(head, text string) string {
+		return "<html><head>" + head + "</head><body>" + text + "</body></html>"
+	}
+	meta := `<meta http-equiv="Content-Type" content="text/html; charset=iso-8859-15">`
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		text        string
+	}{
+		{"utf-8", []byte(page("", "Café, ページ")), "text/html", "Café, ページ"},
+		{"header", encode(t, japanese.ShiftJIS, page("", "ページ")), "text/html; charset=Shift_JIS", "ページ"},
+		{"meta", encode(t, charmap.ISO8859_15, page(meta, "Café, €")), "text/html", "Café, €"},
+		{"bom", encode(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), page("", "Café, ページ")),
+			"text/html; charset=latin1", "Café, ページ"},
+		{"fallback", encode(t, charmap.Windows1252, page("", "Café, €")), "", "Café, €"},
+	}
+
+	for _, test := range tests {
+		decoded, err := ioutil.ReadAll(decodeBody("https://example.com", bytes.NewReader(test.body), test.contentType))
+		assert.NoError(t, err, test.name)
+		assert.Contains(t, string(decoded), test.text, test.name)
+	}
+}
+
+// TestExtractEncodedPage verifies links with non-ASCII paths are found in pages that are not in UTF-8
+func TestExtractEncodedPage(t *testing.T) {
+	params := getTestParameters(time.Second)
+	body := encode(t, japanese.ShiftJIS, `<meta charset="shift_jis"><title>製品</title><a href="/製品/一覧">list</a>`)
+
+	page := params.extract("https://example.com", "text/html", bytes.NewReader(body))
+	assert.Equal(t, "製品", page.title)
+	assert.Equal(t, []string{"https://example.com/%E8%A3%BD%E5%93%81/%E4%B8%80%E8%A6%A7"}, page.links)
+
+	doc := encode(t, charmap.ISO8859_1, `<?xml version="1.0" encoding="ISO-8859-1"?><urlset><url><loc>/café</loc></url></urlset>`)
+	page = params.extract("https://example.com", "application/xml", bytes.NewReader(doc))
+	assert.Equal(t, []string{"https://example.com/caf%C3%A9"}, page.links)
+}
+
+// TestSanitiseNormalises verifies internationalised hosts and percent-encoding are normalised
+func TestSanitiseNormalises(t *testing.T) {
+	tests := []struct{ link, sanitised string }{
+		{"https://bücher.example/a", "https://xn--bcher-kva.example/a"},
+		{"https://BÜCHER.example:8080/a", "https://xn--bcher-kva.example:8080/a"},
+		{"HTTPS://Example.COM/b", "https://example.com/b"},
+		{"/caf%c3%a9", "https://example.com/caf%C3%A9"},
+		{"/café", "https://example.com/caf%C3%A9"},
+		{"/%7Euser/a%20b", "https://example.com/~user/a%20b"},
+		{"/a%2fb", "https://example.com/a%2Fb"},
+		{"/docs/(v2)", "https://example.com/docs/(v2)"},
+		{"https://[::1]:8080/c", "https://[::1]:8080/c"},
+	}
+
+	for _, test := range tests {
+		link, err := sanitise("https://example.com", test.link)
+		assert.NoError(t, err, test.link)
+		assert.Equal(t, test.sanitised, link, test.link)
+	}
+}
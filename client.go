@@ -0,0 +1,44 @@
+package crawl
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// newHTTPClient returns the http.Client used for all requests of a crawl. Its transport keeps connections alive
+// so they are reused across pages, and is set up from the configuration's transport section. Requests go through the
+// proxies selected by proxy.
+func newHTTPClient(conf *config, timeout time.Duration, proxy *proxies) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   conf.Transport.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:               proxy.proxy,
+		DialContext:         dialer.DialContext,
+		MaxIdleConns:        int(conf.Transport.MaxIdleConns),
+		MaxIdleConnsPerHost: int(conf.Transport.MaxIdleConnsPerHost),
+		IdleConnTimeout:     conf.Transport.IdleConnTimeout,
+		TLSHandshakeTimeout: conf.Transport.TLSHandshakeTimeout,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: conf.Transport.TLSInsecure,
+		},
+		ForceAttemptHTTP2: conf.Transport.HTTP2,
+	}
+
+	return newClient(&http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	})
+}
+
+// newClient returns a shallow copy of client that applies the crawler's redirection policy.
+// The copy shares the client's transport, and thus its connection pool.
+func newClient(client *http.Client) *http.Client {
+	c := *client
+	c.CheckRedirect = checkRedirect
+	return &c
+}
@@ -0,0 +1,90 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newPageServer returns a test server answering every request with a small page with links
+func newPageServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `<html><body><a href="/a">a</a><a href="/b">b</a></body></html>`)
+	}))
+}
+
+// TestNewHTTPClient verifies the transport is set up from the configuration
+func TestNewHTTPClient(t *testing.T) {
+	conf := getTestConfig()
+	conf.Transport.MaxIdleConnsPerHost = 7
+	conf.Transport.TLSInsecure = true
+
+	proxy, err := newProxies(conf)
+	if err != nil {
+		t.Fatalf("newProxies() should not fail on valid configuration : %s", err)
+	}
+	client := newHTTPClient(conf, time.Second, proxy)
+
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatal("newHTTPClient() should use an *http.Transport.")
+	}
+	assert.Equal(t, time.Second, client.Timeout)
+	assert.Equal(t, 7, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, conf.Transport.IdleConnTimeout, transport.IdleConnTimeout)
+	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+	assert.NotNil(t, client.CheckRedirect)
+}
+
+// TestWithHTTPClient verifies a given client's transport is used, with the crawler's redirection policy
+func TestWithHTTPClient(t *testing.T) {
+	transport := &http.Transport{}
+	client := &http.Client{Transport: transport}
+
+	params, err := newParameters(getTestConfig(), time.Second, WithHTTPClient(client))
+	if err != nil {
+		t.Fatalf("newParameters() should not fail : %s", err)
+	}
+
+	assert.Equal(t, transport, params.client.Transport)
+	assert.NotNil(t, params.client.CheckRedirect)
+	assert.Nil(t, client.CheckRedirect, "the given client should not be modified")
+}
+
+// BenchmarkScrapSharedClient scraps pages in parallel through a single client
+func BenchmarkScrapSharedClient(b *testing.B) {
+	server := newPageServer()
+	defer server.Close()
+	params := getTestParameters(3 * time.Second)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := cancellableScrapLinks(context.Background(), server.URL, params); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+// BenchmarkScrapClientPerRequest scraps pages in parallel with a new client for each request, without reuse
+func BenchmarkScrapClientPerRequest(b *testing.B) {
+	server := newPageServer()
+	defer server.Close()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			params := getTestParameters(3 * time.Second)
+			if _, err := cancellableScrapLinks(context.Background(), server.URL, params); err != nil {
+				b.Error(err)
+			}
+			params.client.CloseIdleConnections()
+		}
+	})
+}
@@ -3,37 +3,262 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/bytemare/crawl"
 )
 
+// listFlag accumulates the values of a flag that can be given multiple times
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// headerOptions returns the crawler options for the header flags
+func headerOptions(userAgent string, headers, hostHeaders listFlag) ([]crawl.Option, error) {
+	var options []crawl.Option
+
+	if userAgent != "" {
+		options = append(options, crawl.WithUserAgent(userAgent))
+	}
+
+	for _, header := range headers {
+		name, value, err := crawl.ParseHeader(header)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, crawl.WithHeader(name, value))
+	}
+
+	for _, header := range hostHeaders {
+		host, name, value, err := crawl.ParseHostHeader(header)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, crawl.WithHostHeader(host, name, value))
+	}
+
+	return options, nil
+}
+
+// proxyOptions returns the crawler options for the proxy flags
+func proxyOptions(proxy string, hostProxies listFlag) ([]crawl.Option, error) {
+	var options []crawl.Option
+
+	if proxy != "" {
+		u, err := crawl.ParseProxy(proxy, "", "")
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, crawl.WithProxy(u))
+	}
+
+	for _, rule := range hostProxies {
+		host, u, err := crawl.ParseProxyRule(rule, "", "")
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, crawl.WithHostProxy(host, u))
+	}
+
+	return options, nil
+}
+
+// serveMetrics serves the metrics of the crawl on addr, at /metrics, and returns the option to measure it
+func serveMetrics(addr string) crawl.Option {
+	metrics := crawl.NewPrometheusMetrics()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "Error : could not serve metrics : %s\n", err)
+		}
+	}()
+	return crawl.WithMetrics(metrics)
+}
+
+// printStats prints the summary of a crawl to the standard error
+func printStats(stats crawl.Stats) {
+	fmt.Fprintf(os.Stderr, "Visited %d links, %d failed, %d pending, with %d retries, in %s : %.2f pages per second.\n",
+		stats.Visited, stats.Failed, stats.Pending, stats.Retries, stats.End.Sub(stats.Start).Round(time.Millisecond),
+		stats.PagesPerSecond)
+
+	codes := make([]int, 0, len(stats.StatusCodes))
+	for code := range stats.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	counts := make([]string, len(codes))
+	for i, code := range codes {
+		counts[i] = fmt.Sprintf("%d=%d", code, stats.StatusCodes[code])
+	}
+	fmt.Fprintf(os.Stderr, "Status codes : %s\n", strings.Join(counts, " "))
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(diffCommand(os.Args[2:]))
+	}
+
+	var headers, hostHeaders, hostProxies listFlag
+
 	// Define and parse command line arguments
 	timeout := flag.Int("timeout", 0, "crawling time, in seconds. 0 or none is infinite.")
+	userAgent := flag.String("user-agent", "", "User-Agent header sent with requests, overrides the configuration.")
+	flag.Var(&headers, "header", "header sent with every request, as 'Name: value'. Can be repeated.")
+	flag.Var(&hostHeaders, "host-header", "header sent to a single host, as 'host=Name: value'. Can be repeated.")
+	proxy := flag.String("proxy", "", "http, https or socks5 proxy url, with optional credentials, overrides the configuration.")
+	flag.Var(&hostProxies, "host-proxy", "proxy for a single host, as 'host=proxy' or 'host=direct'. Can be repeated.")
+	stateFile := flag.String("state", "", "file the crawl state is saved to on shutdown, to resume it later.")
+	stateInterval := flag.Duration("state-interval", time.Minute, "period of state checkpoints during the crawl, 0 "+
+		"only saves on shutdown.")
+	resume := flag.Bool("resume", false, "continue the crawl saved in the state file.")
+	index := flag.String("index", "", "file the crawled pages are kept in, to only download what changed on the next crawl.")
+	warc := flag.String("warc", "", "directory every request and response is archived to, in WARC files.")
+	mirror := flag.String("mirror", "", "directory the pages are saved to, as an offline copy of the site.")
+	mirrorRewrite := flag.Bool("mirror-rewrite", false, "rewrite links in mirrored pages to point to the local copies.")
+	duplicates := flag.Bool("duplicates", false, "detect duplicate and near-duplicate pages, and print their "+
+		"clusters at the end. The distance and the skipping of links are those of the configuration.")
+	pageInfo := flag.Bool("page-info", false, "extract the metadata of pages : description, canonical, robots, h1 "+
+		"headings, hreflang alternates, Open Graph and word count.")
+	canonical := flag.Bool("canonical", false, "check the canonical links of pages, and print their problems at the end.")
+	canonicalDedupe := flag.Bool("canonical-dedupe", false, "follow the canonical page of pages declaring another "+
+		"one, instead of their links.")
+	ignoreRobots := flag.Bool("ignore-robots", false, "follow links marked nofollow, by their rel attribute, a robots "+
+		"meta tag or a X-Robots-Tag header.")
+	noCompression := flag.Bool("no-compression", false, "ask for uncompressed bodies.")
+	metricsAddr := flag.String("metrics-addr", "", "address the crawl metrics are served on, at /metrics, in the "+
+		"Prometheus text format, e.g. :9090.")
+	format := flag.String("format", formatText, "output format : text, jsonl, csv, or json for a single document.")
+	output := flag.String("output", "", "file the results are written to, instead of the standard output.")
 	flag.Parse()
 
 	if len(flag.Args()) == 0 {
-		fmt.Printf("Expecting at least an url as entry point. e.g. './%s https://bytema.re'\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Expecting at least an url as entry point. e.g. './%s https://bytema.re'\n",
+			filepath.Base(os.Args[0]))
 		os.Exit(1)
 	}
 
 	domain := flag.Args()[0]
 
-	// Launch crawler
-	fmt.Println("Starting web crawler. You can interrupt the program any time with ctrl+c.")
-	crawlerResult, err := crawl.StreamLinks(domain, time.Duration(*timeout)*time.Second)
+	options, err := headerOptions(*userAgent, headers, hostHeaders)
 	if err != nil {
-		fmt.Printf("Error : %s\n", err)
+		fmt.Fprintf(os.Stderr, "Error : %s\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Println("Mapping only shows not yet visited links.")
+	proxies, err := proxyOptions(*proxy, hostProxies)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error : %s\n", err)
+		os.Exit(1)
+	}
+	options = append(options, proxies...)
+
+	if *stateFile != "" {
+		options = append(options, crawl.WithState(*stateFile, *stateInterval))
+	}
+	if *resume {
+		if *stateFile == "" {
+			fmt.Fprintln(os.Stderr, "Error : -resume needs a -state file to resume from.")
+			os.Exit(1)
+		}
+		options = append(options, crawl.WithResume())
+	}
+	if *index != "" {
+		options = append(options, crawl.WithIndex(*index))
+	}
+	if *warc != "" {
+		options = append(options, crawl.WithWARC(*warc, 0))
+	}
+	if *duplicates {
+		options = append(options, crawl.WithDuplicateDetection())
+	}
+	if *mirror != "" {
+		options = append(options, crawl.WithMirror(*mirror, *mirrorRewrite))
+	}
+	if *pageInfo {
+		options = append(options, crawl.WithPageInfo())
+	}
+	if *ignoreRobots {
+		options = append(options, crawl.WithIgnoreRobots())
+	}
+	if *canonical || *canonicalDedupe {
+		options = append(options, crawl.WithCanonical(*canonicalDedupe))
+	}
+	if *noCompression {
+		options = append(options, crawl.WithoutCompression())
+	}
+	if *metricsAddr != "" {
+		options = append(options, serveMetrics(*metricsAddr))
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error : %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	writer, err := newResultWriter(*format, out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error : %s\n", err)
+		os.Exit(1)
+	}
+
+	// Launch crawler. Messages go to the standard error, to keep the output parsable.
+	fmt.Fprintln(os.Stderr, "Starting web crawler. You can interrupt the program any time with ctrl+c.")
+	crawlerResult, err := crawl.StreamLinks(domain, time.Duration(*timeout)*time.Second, options...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error : %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintln(os.Stderr, "Mapping only shows not yet visited links.")
+	status := 0
 	for res := range crawlerResult.Stream() {
-		fmt.Printf("%s -> %s\n", res.URL, *res.Links)
+		if err := writer.write(res); err != nil && status == 0 {
+			fmt.Fprintf(os.Stderr, "Error : could not write results : %s\n", err)
+			status = 1
+		}
+	}
+
+	for _, cluster := range crawlerResult.Duplicates() {
+		kind := "near-duplicates"
+		if cluster.Exact {
+			kind = "duplicates"
+		}
+		fmt.Fprintf(os.Stderr, "%s : %s\n", kind, strings.Join(cluster.URLs, " "))
+	}
+
+	for _, issue := range crawlerResult.CanonicalIssues() {
+		fmt.Fprintf(os.Stderr, "%s canonical : %s -> %s\n", issue.Problem, issue.URL, issue.Canonical)
+	}
+
+	bandwidth := crawlerResult.Bandwidth()
+	fmt.Fprintf(os.Stderr, "Downloaded %d bodies : %d bytes transferred, %d bytes decoded.\n",
+		bandwidth.Pages, bandwidth.Transferred, bandwidth.Decoded)
+	printStats(crawlerResult.Stats())
+
+	if err := writer.close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error : could not write results : %s\n", err)
+		status = 1
+	}
+	if err := out.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error : could not write results : %s\n", err)
+		status = 1
 	}
 
-	os.Exit(0)
+	os.Exit(status)
 }
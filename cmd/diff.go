@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bytemare/crawl"
+)
+
+// printDiff writes a human readable diff to w
+func printDiff(w io.Writer, diff *crawl.CrawlDiff) {
+	if diff.Empty() {
+		_, _ = fmt.Fprintln(w, "No changes.")
+		return
+	}
+
+	for _, url := range diff.Added {
+		_, _ = fmt.Fprintf(w, "+ %s\n", url)
+	}
+	for _, url := range diff.Removed {
+		_, _ = fmt.Fprintf(w, "- %s\n", url)
+	}
+	for _, c := range diff.StatusChanged {
+		_, _ = fmt.Fprintf(w, "~ %s status %d -> %d\n", c.URL, c.Before, c.After)
+	}
+	for _, c := range diff.TitleChanged {
+		_, _ = fmt.Fprintf(w, "~ %s title %q -> %q\n", c.URL, c.Before, c.After)
+	}
+	for _, c := range diff.RedirectsChanged {
+		_, _ = fmt.Fprintf(w, "~ %s redirects %s -> %s\n", c.URL, redirectChain(c.Before), redirectChain(c.After))
+	}
+	for _, l := range diff.NewlyBroken {
+		_, _ = fmt.Fprintf(w, "! %s -> %s broken (%d)\n", l.From, l.To, l.Status)
+	}
+	for _, l := range diff.LinksAdded {
+		_, _ = fmt.Fprintf(w, "+ %s -> %s\n", l.From, l.To)
+	}
+	for _, l := range diff.LinksRemoved {
+		_, _ = fmt.Fprintf(w, "- %s -> %s\n", l.From, l.To)
+	}
+}
+
+// redirectChain returns a short representation of a redirection chain
+func redirectChain(chain []crawl.Redirect) string {
+	if len(chain) == 0 {
+		return "none"
+	}
+	hops := make([]string, len(chain))
+	for i, hop := range chain {
+		hops[i] = fmt.Sprintf("%d %s", hop.Status, hop.Location)
+	}
+	return "[" + strings.Join(hops, ", ") + "]"
+}
+
+// diffCommand runs the diff subcommand on args, and returns the exit code
+func diffCommand(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the diff as JSON.")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage : %s diff [-json] before-index after-index\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 1
+	}
+
+	diff, err := crawl.DiffCrawls(flags.Arg(0), flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error : %s\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diff); err != nil {
+			fmt.Fprintf(os.Stderr, "Error : %s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	printDiff(os.Stdout, diff)
+	return 0
+}
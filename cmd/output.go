@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bytemare/crawl"
+)
+
+// Output formats
+const (
+	formatText  = "text"
+	formatJSONL = "jsonl"
+	formatCSV   = "csv"
+	formatJSON  = "json"
+)
+
+// csvHeader is the first row of the CSV output
+var csvHeader = []string{"url", "final_url", "status", "depth", "title", "change", "error", "redirects", "links",
+	"content_hash", "duplicate_of", "near_duplicate_of", "description", "canonical", "robots", "h1", "hreflang",
+	"word_count", "skipped", "transfer_size", "body_size"}
+
+// redirect is a redirection hop in the structured outputs
+type redirect struct {
+	URL      string `json:"url"`
+	Status   int    `json:"status"`
+	Location string `json:"location"`
+}
+
+// alternate is a version of a page in another language in the structured outputs
+type alternate struct {
+	Lang string `json:"lang"`
+	URL  string `json:"url"`
+}
+
+// skipped is a link that was not followed in the structured outputs
+type skipped struct {
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// result is the schema of a page in the structured outputs. Fields are only ever added to it.
+type result struct {
+	URL       string     `json:"url"`
+	FinalURL  string     `json:"final_url"`
+	Status    int        `json:"status"`
+	Depth     int        `json:"depth"`
+	Title     string     `json:"title"`
+	Change    string     `json:"change"`
+	Error     string     `json:"error"`
+	Redirects []redirect `json:"redirects"`
+	Links     []string   `json:"links"`
+
+	ContentHash     string `json:"content_hash"`
+	DuplicateOf     string `json:"duplicate_of"`
+	NearDuplicateOf string `json:"near_duplicate_of"`
+
+	Description string            `json:"description"`
+	Canonical   string            `json:"canonical"`
+	Robots      string            `json:"robots"`
+	Headings    []string          `json:"h1"`
+	Alternates  []alternate       `json:"hreflang"`
+	OpenGraph   map[string]string `json:"open_graph"`
+	WordCount   int               `json:"word_count"`
+
+	Skipped []skipped `json:"skipped"`
+
+	TransferSize int64 `json:"transfer_size"`
+	BodySize     int64 `json:"body_size"`
+}
+
+// newResult returns the structured output of a LinkMap
+func newResult(res *crawl.LinkMap) *result {
+	r := &result{
+		URL:       res.URL,
+		FinalURL:  res.FinalURL,
+		Status:    res.Status,
+		Depth:     res.Depth,
+		Title:     res.Title,
+		Change:    string(res.Change),
+		Error:     "",
+		Redirects: make([]redirect, len(res.Redirects)),
+		Links:     []string{},
+
+		ContentHash:     res.ContentHash,
+		DuplicateOf:     res.DuplicateOf,
+		NearDuplicateOf: res.NearDuplicateOf,
+
+		Description: "",
+		Canonical:   res.Canonical,
+		Robots:      "",
+		Headings:    []string{},
+		Alternates:  []alternate{},
+		OpenGraph:   map[string]string{},
+		WordCount:   0,
+
+		Skipped: make([]skipped, len(res.Skipped)),
+
+		TransferSize: res.TransferSize,
+		BodySize:     res.BodySize,
+	}
+	if res.Error != nil {
+		r.Error = res.Error.Error()
+	}
+	for i, hop := range res.Redirects {
+		r.Redirects[i] = redirect{URL: hop.URL, Status: hop.Status, Location: hop.Location}
+	}
+	if res.Links != nil {
+		r.Links = append(r.Links, *res.Links...)
+	}
+	for i, link := range res.Skipped {
+		r.Skipped[i] = skipped{URL: link.URL, Reason: string(link.Reason)}
+	}
+	if info := res.Info; info != nil {
+		r.Description, r.Robots, r.WordCount = info.Description, info.Robots, info.WordCount
+		r.Headings = append(r.Headings, info.Headings...)
+		for _, a := range info.Alternates {
+			r.Alternates = append(r.Alternates, alternate{Lang: a.Lang, URL: a.URL})
+		}
+		for name, content := range info.OpenGraph {
+			r.OpenGraph[name] = content
+		}
+	}
+	return r
+}
+
+// resultWriter writes the results of a crawl in an output format
+type resultWriter interface {
+	// write writes a single result
+	write(res *crawl.LinkMap) error
+
+	// close writes what is left once all results are written. It does not close the underlying writer.
+	close() error
+}
+
+// newResultWriter returns a resultWriter for format, writing to w
+func newResultWriter(format string, w io.Writer) (resultWriter, error) {
+	switch format {
+	case formatText:
+		return &textWriter{w: w}, nil
+	case formatJSONL:
+		return &jsonlWriter{encoder: json.NewEncoder(w)}, nil
+	case formatCSV:
+		c := &csvWriter{w: csv.NewWriter(w)}
+		return c, c.w.Write(csvHeader)
+	case formatJSON:
+		return &jsonWriter{w: w, results: []*result{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown format '%s', expected %s, %s, %s or %s", format, formatText, formatJSONL,
+			formatCSV, formatJSON)
+	}
+}
+
+// textWriter writes results for humans
+type textWriter struct {
+	w io.Writer
+}
+
+func (t *textWriter) write(res *crawl.LinkMap) error {
+	prefix := ""
+	if res.Change != "" {
+		prefix = fmt.Sprintf("[%s] ", res.Change)
+	}
+	if res.Error != nil {
+		_, err := fmt.Fprintf(t.w, "%s%s -> error : %s\n", prefix, res.URL, res.Error)
+		return err
+	}
+	for _, hop := range res.Redirects {
+		if _, err := fmt.Fprintf(t.w, "%s => %d %s\n", hop.URL, hop.Status, hop.Location); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(t.w, "%s%s -> %s\n", prefix, res.URL, *res.Links)
+	return err
+}
+
+func (t *textWriter) close() error {
+	return nil
+}
+
+// jsonlWriter writes a JSON document per result and line
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (j *jsonlWriter) write(res *crawl.LinkMap) error {
+	return j.encoder.Encode(newResult(res))
+}
+
+func (j *jsonlWriter) close() error {
+	return nil
+}
+
+// csvWriter writes a CSV row per result. Redirection locations, links, hreflang alternates and skipped links are
+// separated by spaces, and h1 headings by new lines. Open Graph properties are left out.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) write(res *crawl.LinkMap) error {
+	r := newResult(res)
+	locations := make([]string, len(r.Redirects))
+	for i, hop := range r.Redirects {
+		locations[i] = hop.Location
+	}
+	alternates := make([]string, len(r.Alternates))
+	for i, a := range r.Alternates {
+		alternates[i] = a.Lang + "=" + a.URL
+	}
+	skips := make([]string, len(r.Skipped))
+	for i, s := range r.Skipped {
+		skips[i] = s.Reason + "=" + s.URL
+	}
+
+	err := c.w.Write([]string{
+		r.URL,
+		r.FinalURL,
+		strconv.Itoa(r.Status),
+		strconv.Itoa(r.Depth),
+		r.Title,
+		r.Change,
+		r.Error,
+		strings.Join(locations, " "),
+		strings.Join(r.Links, " "),
+		r.ContentHash,
+		r.DuplicateOf,
+		r.NearDuplicateOf,
+		r.Description,
+		r.Canonical,
+		r.Robots,
+		strings.Join(r.Headings, "\n"),
+		strings.Join(alternates, " "),
+		strconv.Itoa(r.WordCount),
+		strings.Join(skips, " "),
+		strconv.FormatInt(r.TransferSize, 10),
+		strconv.FormatInt(r.BodySize, 10),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Flush every row, so that interrupted crawls have their results
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonWriter writes a single JSON array of all results once the crawl is over
+type jsonWriter struct {
+	w       io.Writer
+	results []*result
+}
+
+func (j *jsonWriter) write(res *crawl.LinkMap) error {
+	j.results = append(j.results, newResult(res))
+	return nil
+}
+
+func (j *jsonWriter) close() error {
+	encoder := json.NewEncoder(j.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(j.results)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bytemare/crawl"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPages returns a page with every field set, and a page that could not be retrieved
+func testPages() []*crawl.LinkMap {
+	links := []string{"https://example.com/d", "https://example.com/e"}
+	page := &crawl.LinkMap{
+		URL:             "https://example.com/a",
+		FinalURL:        "https://example.com/b",
+		Status:          200,
+		Depth:           1,
+		Title:           "B",
+		ETag:            `"1"`,
+		LastModified:    "",
+		Canonical:       "https://example.com/b",
+		ContentHash:     "abc",
+		SimHash:         7,
+		DuplicateOf:     "",
+		NearDuplicateOf: "https://example.com/c",
+		Change:          crawl.PageChanged,
+		Info: &crawl.PageInfo{
+			Title:       "B",
+			Description: "desc",
+			Canonical:   "https://example.com/b",
+			Robots:      "index",
+			Alternates:  []crawl.Alternate{{Lang: "fr", URL: "https://example.com/fr"}},
+			Headings:    []string{"One", "Two"},
+			OpenGraph:   map[string]string{"title": "B"},
+			WordCount:   42,
+		},
+		Redirects:    []crawl.Redirect{{URL: "https://example.com/a", Status: 301, Location: "https://example.com/b"}},
+		Links:        &links,
+		Skipped:      []crawl.SkippedLink{{URL: "https://example.com/f", Reason: crawl.SkipNofollowLink}},
+		TransferSize: 100,
+		BodySize:     300,
+		Error:        nil,
+	}
+	failed := &crawl.LinkMap{URL: "https://example.com/x", Error: errors.New("timeout")}
+	return []*crawl.LinkMap{page, failed}
+}
+
+// TestNewResult verifies LinkMaps are converted to the documented schema, without nil lists
+func TestNewResult(t *testing.T) {
+	pages := testPages()
+	tests := []struct {
+		page   *crawl.LinkMap
+		result *result
+	}{
+		{pages[0], &result{
+			URL:             "https://example.com/a",
+			FinalURL:        "https://example.com/b",
+			Status:          200,
+			Depth:           1,
+			Title:           "B",
+			Change:          "changed",
+			Error:           "",
+			Redirects:       []redirect{{URL: "https://example.com/a", Status: 301, Location: "https://example.com/b"}},
+			Links:           []string{"https://example.com/d", "https://example.com/e"},
+			ContentHash:     "abc",
+			DuplicateOf:     "",
+			NearDuplicateOf: "https://example.com/c",
+			Description:     "desc",
+			Canonical:       "https://example.com/b",
+			Robots:          "index",
+			Headings:        []string{"One", "Two"},
+			Alternates:      []alternate{{Lang: "fr", URL: "https://example.com/fr"}},
+			OpenGraph:       map[string]string{"title": "B"},
+			WordCount:       42,
+			Skipped:         []skipped{{URL: "https://example.com/f", Reason: "nofollow-link"}},
+			TransferSize:    100,
+			BodySize:        300,
+		}},
+		{pages[1], &result{
+			URL:             "https://example.com/x",
+			FinalURL:        "",
+			Status:          0,
+			Depth:           0,
+			Title:           "",
+			Change:          "",
+			Error:           "timeout",
+			Redirects:       []redirect{},
+			Links:           []string{},
+			ContentHash:     "",
+			DuplicateOf:     "",
+			NearDuplicateOf: "",
+			Description:     "",
+			Canonical:       "",
+			Robots:          "",
+			Headings:        []string{},
+			Alternates:      []alternate{},
+			OpenGraph:       map[string]string{},
+			WordCount:       0,
+			Skipped:         []skipped{},
+			TransferSize:    0,
+			BodySize:        0,
+		}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.result, newResult(test.page), test.page.URL)
+	}
+}
+
+// TestResultWriters verifies the output of every format
+func TestResultWriters(t *testing.T) {
+	page := `{"url":"https://example.com/a","final_url":"https://example.com/b","status":200,"depth":1,"title":"B",` +
+		`"change":"changed","error":"","redirects":[{"url":"https://example.com/a","status":301,` +
+		`"location":"https://example.com/b"}],"links":["https://example.com/d","https://example.com/e"],` +
+		`"content_hash":"abc","duplicate_of":"","near_duplicate_of":"https://example.com/c","description":"desc",` +
+		`"canonical":"https://example.com/b","robots":"index","h1":["One","Two"],` +
+		`"hreflang":[{"lang":"fr","url":"https://example.com/fr"}],"open_graph":{"title":"B"},"word_count":42,` +
+		`"skipped":[{"url":"https://example.com/f","reason":"nofollow-link"}],"transfer_size":100,"body_size":300}`
+	failed := `{"url":"https://example.com/x","final_url":"","status":0,"depth":0,"title":"","change":"",` +
+		`"error":"timeout","redirects":[],"links":[],"content_hash":"","duplicate_of":"","near_duplicate_of":"",` +
+		`"description":"","canonical":"","robots":"","h1":[],"hreflang":[],"open_graph":{},"word_count":0,` +
+		`"skipped":[],"transfer_size":0,"body_size":0}`
+
+	tests := []struct {
+		format, output string
+	}{
+		{formatText, "https://example.com/a => 301 https://example.com/b\n" +
+			"[changed] https://example.com/a -> [https://example.com/d https://example.com/e]\n" +
+			"https://example.com/x -> error : timeout\n"},
+		{formatJSONL, page + "\n" + failed + "\n"},
+		{formatCSV, strings.Join(csvHeader, ",") + "\n" +
+			"https://example.com/a,https://example.com/b,200,1,B,changed,,https://example.com/b," +
+			"https://example.com/d https://example.com/e,abc,,https://example.com/c,desc,https://example.com/b,index," +
+			"\"One\nTwo\",fr=https://example.com/fr,42,nofollow-link=https://example.com/f,100,300\n" +
+			"https://example.com/x,,0,0,,,timeout,,,,,,,,,,,0,,0,0\n"},
+	}
+
+	for _, test := range tests {
+		var out bytes.Buffer
+		w, err := newResultWriter(test.format, &out)
+		assert.NoError(t, err, test.format)
+		for _, res := range testPages() {
+			assert.NoError(t, w.write(res), test.format)
+		}
+		assert.NoError(t, w.close(), test.format)
+		assert.Equal(t, test.output, out.String(), test.format)
+	}
+
+	// JSON is a single document, only written once closed
+	var out bytes.Buffer
+	w, err := newResultWriter(formatJSON, &out)
+	assert.NoError(t, err)
+	for _, res := range testPages() {
+		assert.NoError(t, w.write(res))
+	}
+	assert.Empty(t, out.String())
+	assert.NoError(t, w.close())
+	var compact bytes.Buffer
+	assert.NoError(t, json.Compact(&compact, out.Bytes()))
+	assert.Equal(t, "["+page+","+failed+"]", compact.String())
+
+	// Without results, it is an empty array
+	out.Reset()
+	w, _ = newResultWriter(formatJSON, &out)
+	assert.NoError(t, w.close())
+	assert.Equal(t, "[]\n", out.String())
+
+	_, err = newResultWriter("xml", &out)
+	assert.Error(t, err)
+}
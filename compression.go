@@ -0,0 +1,171 @@
+package crawl
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/pkg/errors"
+)
+
+var (
+	errBodyTooLarge  = errors.New("body is larger than allowed once decoded")
+	errBodyTooSparse = errors.New("body decompresses beyond the allowed ratio, possibly a decompression bomb")
+)
+
+const (
+	// acceptEncoding is the Accept-Encoding header sent when compression is enabled
+	acceptEncoding = "gzip, deflate, br"
+
+	// ratioThreshold is the decoded size from which the compression ratio of a body is checked, for small bodies,
+	// that compress well, not to be taken for bombs
+	ratioThreshold = 1 << 20
+)
+
+// Bandwidth sums up how much was downloaded during a crawl
+type Bandwidth struct {
+	Pages       int   // number of responses whose body was read
+	Transferred int64 // bytes of bodies received, as they were encoded
+	Decoded     int64 // bytes of bodies once decoded
+}
+
+// add counts the body sizes of a page, if it was read
+func (b *Bandwidth) add(res *LinkMap) {
+	if res.TransferSize == 0 && res.BodySize == 0 {
+		return
+	}
+	b.Pages++
+	b.Transferred += res.TransferSize
+	b.Decoded += res.BodySize
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// bodySizer is implemented by response bodies that know their size, as received and once decoded
+type bodySizer interface {
+	sizes() (transferred, decoded int64)
+}
+
+// decodedBody decodes a response body according to its content encodings, counting bytes as they were received and
+// once decoded. Reading fails if the decoded body is larger than maxSize or, once larger than ratioThreshold, than
+// maxRatio times the received bytes. A limit of 0 is no limit.
+type decodedBody struct {
+	raw       io.ReadCloser
+	wire      *countingReader
+	encodings []string
+	decoder   io.Reader // set up on the first read, as decoders read a header
+	decoded   int64
+	maxSize   int64
+	maxRatio  int64
+	err       error // once reading failed, it always does
+}
+
+// newDecodedBody returns the body of resp, decoded according to its Content-Encoding header
+func newDecodedBody(resp *http.Response, maxSize, maxRatio int64) *decodedBody {
+	var encodings []string
+	for _, e := range strings.Split(resp.Header.Get("Content-Encoding"), ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" && e != "identity" {
+			encodings = append(encodings, e)
+		}
+	}
+
+	return &decodedBody{
+		raw:       resp.Body,
+		wire:      &countingReader{r: resp.Body, n: 0},
+		encodings: encodings,
+		decoder:   nil,
+		decoded:   0,
+		maxSize:   maxSize,
+		maxRatio:  maxRatio,
+		err:       nil,
+	}
+}
+
+// decoder returns a reader decoding r, encoded with encoding
+func decoder(encoding string, r io.Reader) (io.Reader, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		// Deflate should be zlib wrapped, but some servers send raw deflate data
+		buffered := bufio.NewReader(r)
+		header, err := buffered.Peek(2)
+		if err != nil {
+			return nil, err
+		}
+		if header[0]&0x0f == 8 && (uint(header[0])<<8|uint(header[1]))%31 == 0 {
+			return zlib.NewReader(buffered)
+		}
+		return flate.NewReader(buffered), nil
+	case "br":
+		return brotli.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding '%s'", encoding)
+	}
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	// Encodings are listed in the order they were applied
+	if b.decoder == nil {
+		var r io.Reader = b.wire
+		for i := len(b.encodings) - 1; i >= 0; i-- {
+			d, err := decoder(b.encodings[i], r)
+			if err != nil {
+				b.err = errors.Wrap(err, "Could not decode body")
+				return 0, b.err
+			}
+			r = d
+		}
+		b.decoder = r
+	}
+
+	n, err := b.decoder.Read(p)
+	b.decoded += int64(n)
+	switch {
+	case b.maxSize > 0 && b.decoded > b.maxSize:
+		b.err = errBodyTooLarge
+	case b.maxRatio > 0 && b.decoded > ratioThreshold && b.decoded > b.maxRatio*b.wire.n:
+		b.err = errBodyTooSparse
+	default:
+		return n, err
+	}
+	return 0, b.err
+}
+
+func (b *decodedBody) Close() error {
+	return b.raw.Close()
+}
+
+func (b *decodedBody) sizes() (int64, int64) {
+	return b.wire.n, b.decoded
+}
+
+// isBodyError returns whether the error was caused by a body too large, in which case retrying is pointless
+func isBodyError(err error) bool {
+	cause := errors.Cause(err)
+	if uerr, ok := cause.(*url.Error); ok {
+		cause = uerr.Err
+	}
+	return cause == errBodyTooLarge || cause == errBodyTooSparse
+}
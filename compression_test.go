@@ -0,0 +1,161 @@
+package crawl
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+)
+
+// compress returns data encoded with the given content encoding
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "deflate":
+		return []byte(deflate(string(data)))
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&b, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&b)
+	default:
+		t.Fatalf("unknown encoding %s", encoding)
+	}
+	_, _ = w.Write(data)
+	_ = w.Close()
+	return b.Bytes()
+}
+
+// encodedResponse returns a response with body and its Content-Encoding header
+func encodedResponse(encoding string, body []byte) *http.Response {
+	resp := &http.Response{Header: make(http.Header), Body: ioutil.NopCloser(bytes.NewReader(body))}
+	resp.Header.Set("Content-Encoding", encoding)
+	return resp
+}
+
+// TestDecodedBody verifies bodies are decoded, whatever their encodings, and their sizes counted
+func TestDecodedBody(t *testing.T) {
+	page := []byte(strings.Repeat(`<a href="/page">page</a>`, 100))
+	tests := []struct {
+		name, header string
+		body         []byte
+	}{
+		{"identity", "", page},
+		{"gzip", "gzip", compress(t, "gzip", page)},
+		{"x-gzip", "X-Gzip", compress(t, "gzip", page)},
+		{"zlib deflate", "deflate", compress(t, "deflate", page)},
+		{"raw deflate", "deflate", compress(t, "raw-deflate", page)},
+		{"brotli", "br", compress(t, "br", page)},
+		{"chained", "deflate, gzip", compress(t, "gzip", compress(t, "deflate", page))},
+	}
+
+	for _, test := range tests {
+		body := newDecodedBody(encodedResponse(test.header, test.body), 0, 0)
+		decoded, err := ioutil.ReadAll(body)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, page, decoded, test.name)
+
+		transferred, size := body.sizes()
+		assert.Equal(t, int64(len(test.body)), transferred, test.name)
+		assert.Equal(t, int64(len(page)), size, test.name)
+	}
+
+	_, err := ioutil.ReadAll(newDecodedBody(encodedResponse("compress", page), 0, 0))
+	assert.Error(t, err)
+}
+
+// TestDecodedBodyLimits verifies reading stops when bodies are too large, or decompress too much
+func TestDecodedBodyLimits(t *testing.T) {
+	zeros := make([]byte, 4<<20)
+	bomb := compress(t, "gzip", zeros)
+
+	_, err := ioutil.ReadAll(newDecodedBody(encodedResponse("gzip", bomb), 1<<20, 0))
+	assert.Equal(t, errBodyTooLarge, err)
+
+	body := newDecodedBody(encodedResponse("gzip", bomb), 0, 100)
+	_, err = ioutil.ReadAll(body)
+	assert.Equal(t, errBodyTooSparse, err)
+	assert.True(t, isBodyError(err))
+	_, err = body.Read(make([]byte, 1))
+	assert.Equal(t, errBodyTooSparse, err)
+
+	// Small bodies compressing well are not bombs
+	small := make([]byte, 512<<10)
+	decoded, err := ioutil.ReadAll(newDecodedBody(encodedResponse("gzip", compress(t, "gzip", small)), 0, 100))
+	assert.NoError(t, err)
+	assert.Len(t, decoded, len(small))
+}
+
+// TestCrawlCompressed verifies compressed pages are crawled, bombs are not retried, and bandwidth is summed up
+func TestCrawlCompressed(t *testing.T) {
+	var mutex sync.Mutex
+	var accepted []string
+	hits := make(map[string]int)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		accepted = append(accepted, r.Header.Get("Accept-Encoding"))
+		hits[r.URL.Path]++
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(compress(t, "gzip", []byte(`<a href="/br">br</a><a href="/bomb">bomb</a>`)))
+		case "/br":
+			w.Header().Set("Content-Encoding", "br")
+			_, _ = w.Write(compress(t, "br", []byte(`<a href="/plain">plain</a>`)))
+		case "/bomb":
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(compress(t, "gzip", make([]byte, 4<<20)))
+		default:
+			_, _ = fmt.Fprint(w, `<title>plain</title>`)
+		}
+	}))
+	defer site.Close()
+
+	syn := newSynchron(0, 1)
+	results := newCrawlerResults(syn)
+	go func() {
+		crawl(site.URL, syn, getTestConfig())
+		close(syn.results)
+	}()
+	pages := make(map[string]*LinkMap)
+	for res := range syn.results {
+		pages[res.URL] = res
+	}
+
+	assert.Len(t, pages, 4)
+	assert.Equal(t, "plain", pages[site.URL+"/plain"].Title)
+	assert.True(t, isBodyError(pages[site.URL+"/bomb"].Error))
+	assert.Equal(t, 1, hits["/bomb"])
+	for _, accept := range accepted {
+		assert.Equal(t, acceptEncoding, accept)
+	}
+
+	var transferred, decoded int64
+	for _, res := range pages {
+		transferred += res.TransferSize
+		decoded += res.BodySize
+	}
+	root := pages[site.URL]
+	assert.True(t, root.TransferSize > 0 && root.TransferSize != root.BodySize)
+	assert.Equal(t, Bandwidth{Pages: 4, Transferred: transferred, Decoded: decoded}, results.Bandwidth())
+
+	// Without compression, servers are asked not to compress
+	accepted = nil
+	runCrawl(site.URL+"/plain", getTestConfig(), WithoutCompression())
+	assert.Equal(t, []string{"identity"}, accepted)
+}
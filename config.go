@@ -24,9 +24,79 @@ func configFile() string {
 // Environment variables overwrite configuration file values.
 type config struct {
 	Requests struct {
-		Timeout time.Duration `yaml:"timeout" envconfig:"CRAWLER_REQ_TIMEOUT"`
-		Retries uint          `yaml:"retries" envconfig:"CRAWLER_REQ_RETRIES"`
+		Timeout        time.Duration `yaml:"timeout" envconfig:"CRAWLER_REQ_TIMEOUT"`
+		Retries        uint          `yaml:"retries" envconfig:"CRAWLER_REQ_RETRIES"`
+		MaxRedirects   int           `yaml:"max_redirects" envconfig:"CRAWLER_REQ_MAX_REDIRECTS"`
+		UserAgent      string        `yaml:"user_agent" envconfig:"CRAWLER_REQ_USER_AGENT"`
+		Accept         string        `yaml:"accept" envconfig:"CRAWLER_REQ_ACCEPT"`
+		AcceptLanguage string        `yaml:"accept_language" envconfig:"CRAWLER_REQ_ACCEPT_LANGUAGE"`
+		Headers        string        `yaml:"headers" envconfig:"CRAWLER_REQ_HEADERS"`
+		HostHeaders    string        `yaml:"host_headers" envconfig:"CRAWLER_REQ_HOST_HEADERS"`
 	} `yaml:"requests"`
+	Transport struct {
+		MaxIdleConns        uint          `yaml:"max_idle_conns" envconfig:"CRAWLER_HTTP_MAX_IDLE_CONNS"`
+		MaxIdleConnsPerHost uint          `yaml:"max_idle_conns_per_host" envconfig:"CRAWLER_HTTP_MAX_IDLE_CONNS_PER_HOST"`
+		IdleConnTimeout     time.Duration `yaml:"idle_conn_timeout" envconfig:"CRAWLER_HTTP_IDLE_CONN_TIMEOUT"`
+		DialTimeout         time.Duration `yaml:"dial_timeout" envconfig:"CRAWLER_HTTP_DIAL_TIMEOUT"`
+		TLSHandshakeTimeout time.Duration `yaml:"tls_handshake_timeout" envconfig:"CRAWLER_HTTP_TLS_HANDSHAKE_TIMEOUT"`
+		TLSInsecure         bool          `yaml:"tls_insecure" envconfig:"CRAWLER_HTTP_TLS_INSECURE"`
+		HTTP2               bool          `yaml:"http2" envconfig:"CRAWLER_HTTP2"`
+		Proxy               string        `yaml:"proxy" envconfig:"CRAWLER_HTTP_PROXY"`
+		ProxyRules          string        `yaml:"proxy_rules" envconfig:"CRAWLER_HTTP_PROXY_RULES"`
+		ProxyUsername       string        `yaml:"proxy_username" envconfig:"CRAWLER_HTTP_PROXY_USERNAME"`
+		ProxyPassword       string        `yaml:"proxy_password" envconfig:"CRAWLER_HTTP_PROXY_PASSWORD"`
+	} `yaml:"transport"`
+	Auth struct {
+		Cookies     bool   `yaml:"cookies" envconfig:"CRAWLER_AUTH_COOKIES"`
+		CookiesFile string `yaml:"cookies_file" envconfig:"CRAWLER_AUTH_COOKIES_FILE"`
+		Username    string `yaml:"username" envconfig:"CRAWLER_AUTH_USERNAME"`
+		Password    string `yaml:"password" envconfig:"CRAWLER_AUTH_PASSWORD"`
+		Token       string `yaml:"token" envconfig:"CRAWLER_AUTH_TOKEN"`
+		LoginURL    string `yaml:"login_url" envconfig:"CRAWLER_AUTH_LOGIN_URL"`
+		LoginForm   string `yaml:"login_form" envconfig:"CRAWLER_AUTH_LOGIN_FORM"`
+	} `yaml:"auth"`
+	State struct {
+		File     string        `yaml:"file" envconfig:"CRAWLER_STATE_FILE"`
+		Interval time.Duration `yaml:"interval" envconfig:"CRAWLER_STATE_INTERVAL"`
+		Resume   bool          `yaml:"resume" envconfig:"CRAWLER_STATE_RESUME"`
+		Store    string        `yaml:"store" envconfig:"CRAWLER_STATE_STORE"`
+		Path     string        `yaml:"path" envconfig:"CRAWLER_STATE_STORE_PATH"`
+		Index    string        `yaml:"index" envconfig:"CRAWLER_STATE_INDEX"`
+	} `yaml:"state"`
+	Dedup struct {
+		Filter        string  `yaml:"filter" envconfig:"CRAWLER_DEDUP_FILTER"`
+		FalsePositive float64 `yaml:"false_positive" envconfig:"CRAWLER_DEDUP_FALSE_POSITIVE"`
+		Threshold     uint    `yaml:"threshold" envconfig:"CRAWLER_DEDUP_THRESHOLD"`
+	} `yaml:"dedup"`
+	Archive struct {
+		Dir     string `yaml:"dir" envconfig:"CRAWLER_WARC_DIR"`
+		Prefix  string `yaml:"prefix" envconfig:"CRAWLER_WARC_PREFIX"`
+		MaxSize uint   `yaml:"max_size" envconfig:"CRAWLER_WARC_MAX_SIZE"`
+	} `yaml:"archive"`
+	Mirror struct {
+		Dir     string `yaml:"dir" envconfig:"CRAWLER_MIRROR_DIR"`
+		Rewrite bool   `yaml:"rewrite" envconfig:"CRAWLER_MIRROR_REWRITE"`
+	} `yaml:"mirror"`
+	Duplicates struct {
+		Detect    bool `yaml:"detect" envconfig:"CRAWLER_DUP_DETECT"`
+		Distance  uint `yaml:"distance" envconfig:"CRAWLER_DUP_DISTANCE"`
+		SkipLinks bool `yaml:"skip_links" envconfig:"CRAWLER_DUP_SKIP_LINKS"`
+	} `yaml:"duplicates"`
+	Extract struct {
+		PageInfo bool `yaml:"page_info" envconfig:"CRAWLER_EXTRACT_PAGE_INFO"`
+	} `yaml:"extract"`
+	Robots struct {
+		Ignore bool `yaml:"ignore" envconfig:"CRAWLER_ROBOTS_IGNORE"`
+	} `yaml:"robots"`
+	Canonical struct {
+		Check  bool `yaml:"check" envconfig:"CRAWLER_CANONICAL_CHECK"`
+		Dedupe bool `yaml:"dedupe" envconfig:"CRAWLER_CANONICAL_DEDUPE"`
+	} `yaml:"canonical"`
+	Body struct {
+		Compression bool `yaml:"compression" envconfig:"CRAWLER_BODY_COMPRESSION"`
+		MaxSize     uint `yaml:"max_size" envconfig:"CRAWLER_BODY_MAX_SIZE"`
+		MaxRatio    uint `yaml:"max_ratio" envconfig:"CRAWLER_BODY_MAX_RATIO"`
+	} `yaml:"body"`
 	Logging struct {
 		Level       uint   `yaml:"level" envconfig:"CRAWLER_LOG_LEVEL"`
 		Output      string `yaml:"output" envconfig:"CRAWLER_LOG_OUTPUT"`
@@ -43,6 +113,54 @@ func configGetEnvKeys() []string {
 	envKeys := []string{
 		"CRAWLER_REQ_TIMEOUT",
 		"CRAWLER_REQ_RETRIES",
+		"CRAWLER_REQ_MAX_REDIRECTS",
+		"CRAWLER_REQ_USER_AGENT",
+		"CRAWLER_REQ_ACCEPT",
+		"CRAWLER_REQ_ACCEPT_LANGUAGE",
+		"CRAWLER_REQ_HEADERS",
+		"CRAWLER_REQ_HOST_HEADERS",
+		"CRAWLER_HTTP_MAX_IDLE_CONNS",
+		"CRAWLER_HTTP_MAX_IDLE_CONNS_PER_HOST",
+		"CRAWLER_HTTP_IDLE_CONN_TIMEOUT",
+		"CRAWLER_HTTP_DIAL_TIMEOUT",
+		"CRAWLER_HTTP_TLS_HANDSHAKE_TIMEOUT",
+		"CRAWLER_HTTP_TLS_INSECURE",
+		"CRAWLER_HTTP2",
+		"CRAWLER_HTTP_PROXY",
+		"CRAWLER_HTTP_PROXY_RULES",
+		"CRAWLER_HTTP_PROXY_USERNAME",
+		"CRAWLER_HTTP_PROXY_PASSWORD",
+		"CRAWLER_AUTH_COOKIES",
+		"CRAWLER_AUTH_COOKIES_FILE",
+		"CRAWLER_AUTH_USERNAME",
+		"CRAWLER_AUTH_PASSWORD",
+		"CRAWLER_AUTH_TOKEN",
+		"CRAWLER_AUTH_LOGIN_URL",
+		"CRAWLER_AUTH_LOGIN_FORM",
+		"CRAWLER_STATE_FILE",
+		"CRAWLER_STATE_INTERVAL",
+		"CRAWLER_STATE_RESUME",
+		"CRAWLER_STATE_STORE",
+		"CRAWLER_STATE_STORE_PATH",
+		"CRAWLER_STATE_INDEX",
+		"CRAWLER_DEDUP_FILTER",
+		"CRAWLER_DEDUP_FALSE_POSITIVE",
+		"CRAWLER_DEDUP_THRESHOLD",
+		"CRAWLER_WARC_DIR",
+		"CRAWLER_WARC_PREFIX",
+		"CRAWLER_WARC_MAX_SIZE",
+		"CRAWLER_MIRROR_DIR",
+		"CRAWLER_MIRROR_REWRITE",
+		"CRAWLER_DUP_DETECT",
+		"CRAWLER_DUP_DISTANCE",
+		"CRAWLER_DUP_SKIP_LINKS",
+		"CRAWLER_EXTRACT_PAGE_INFO",
+		"CRAWLER_ROBOTS_IGNORE",
+		"CRAWLER_CANONICAL_CHECK",
+		"CRAWLER_CANONICAL_DEDUPE",
+		"CRAWLER_BODY_COMPRESSION",
+		"CRAWLER_BODY_MAX_SIZE",
+		"CRAWLER_BODY_MAX_RATIO",
 		"CRAWLER_LOG",
 		"CRAWLER_LOG_LEVEL",
 		"CRAWLER_LOG_OUTPUT",
@@ -57,21 +175,78 @@ func configGetEnvKeys() []string {
 // configGetEmergencyConf returns a minimal configuration only used when no config file or env vars are set
 // Warning : logging is disabled.
 func configGetEmergencyConf() *config {
-	return &config{
-		Requests: struct {
-			Timeout time.Duration `yaml:"timeout" envconfig:"CRAWLER_REQ_TIMEOUT"`
-			Retries uint          `yaml:"retries" envconfig:"CRAWLER_REQ_RETRIES"`
-		}{0, 3},
-		Logging: struct {
-			Level       uint   `yaml:"level" envconfig:"CRAWLER_LOG_LEVEL"`
-			Output      string `yaml:"output" envconfig:"CRAWLER_LOG_OUTPUT"`
-			File        string `yaml:"file" envconfig:"CRAWLER_LOG_FILE"`
-			Type        string `yaml:"type" envconfig:"CRAWLER_LOG_TYPE"`
-			Permissions uint   `yaml:"perms" envconfig:"CRAWLER_LOG_FILE_PERMS"`
-			Do          bool   `yaml:"do" envconfig:"CRAWLER_LOG"`
-			fileDes     *os.File
-		}{2, "stdout", "", "text", 0, false, nil},
-	}
+	conf := &config{}
+
+	conf.Requests.Timeout = 0
+	conf.Requests.Retries = 3
+	conf.Requests.MaxRedirects = defaultMaxRedirects
+	conf.Requests.UserAgent = defaultUserAgent
+	conf.Requests.Accept = defaultAccept
+	conf.Requests.AcceptLanguage = defaultAcceptLanguage
+	conf.Requests.Headers = ""
+	conf.Requests.HostHeaders = ""
+
+	conf.Transport.MaxIdleConns = 100
+	conf.Transport.MaxIdleConnsPerHost = 32
+	conf.Transport.IdleConnTimeout = 90 * time.Second
+	conf.Transport.DialTimeout = 30 * time.Second
+	conf.Transport.TLSHandshakeTimeout = 10 * time.Second
+	conf.Transport.TLSInsecure = false
+	conf.Transport.HTTP2 = true
+	conf.Transport.Proxy = ""
+	conf.Transport.ProxyRules = ""
+	conf.Transport.ProxyUsername = ""
+	conf.Transport.ProxyPassword = ""
+
+	conf.Auth.Cookies = false
+	conf.Auth.CookiesFile = ""
+	conf.Auth.Username = ""
+	conf.Auth.Password = ""
+	conf.Auth.Token = ""
+	conf.Auth.LoginURL = ""
+	conf.Auth.LoginForm = ""
+
+	conf.State.File = ""
+	conf.State.Interval = 0
+	conf.State.Resume = false
+	conf.State.Store = storeMemory
+	conf.State.Path = ""
+	conf.State.Index = ""
+
+	conf.Dedup.Filter = dedupExact
+	conf.Dedup.FalsePositive = 0.001
+	conf.Dedup.Threshold = 100000
+
+	conf.Archive.Dir = ""
+	conf.Archive.Prefix = warcDefaultPrefix
+	conf.Archive.MaxSize = warcDefaultMaxSize
+
+	conf.Mirror.Dir = ""
+	conf.Mirror.Rewrite = false
+
+	conf.Duplicates.Detect = false
+	conf.Duplicates.Distance = 3
+	conf.Duplicates.SkipLinks = false
+
+	conf.Extract.PageInfo = false
+
+	conf.Robots.Ignore = false
+
+	conf.Canonical.Check = false
+	conf.Canonical.Dedupe = false
+
+	conf.Body.Compression = true
+	conf.Body.MaxSize = 64 << 20
+	conf.Body.MaxRatio = 100
+
+	conf.Logging.Level = 2
+	conf.Logging.Output = "stdout"
+	conf.Logging.File = ""
+	conf.Logging.Type = "text"
+	conf.Logging.Permissions = 0
+	conf.Logging.Do = false
+
+	return conf
 }
 
 // initialiseCrawlConfiguration attempts to load the configuration from environment variables and a configuration file.
@@ -245,6 +420,7 @@ func configLoadFile(config *config, filePath string) (bool, error) {
 		return true, errors.Wrapf(err, "Unable to parse config file '%s'", filePath)
 	}
 
+	configSetDefaults(config)
 	return true, nil
 }
 
@@ -255,9 +431,18 @@ func configLoadEnv() (*config, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Unable to gather Env vars for configuration")
 	}
+	configSetDefaults(&config)
 	return &config, nil
 }
 
+// configSetDefaults sets the values of keys that were added after configurations were written, and are missing from
+// them, for these to keep working as before
+func configSetDefaults(conf *config) {
+	if conf.Requests.MaxRedirects == 0 {
+		conf.Requests.MaxRedirects = defaultMaxRedirects
+	}
+}
+
 // configUpdateEnvConfig populates key:value in conf
 /*func configUpdateEnvConfig(conf *config, key string, value interface{}) error {
 	yamlVal := key + ": " + fmt.Sprintf("%v", value)
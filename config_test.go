@@ -101,6 +101,38 @@ func restoreConfigFileAndEnv(t *testing.T, test *configTest, env []string) {
 	}
 }
 
+// TestConfigMaxRedirectsDefault verifies redirections are followed when the key is missing from a configuration
+func TestConfigMaxRedirectsDefault(t *testing.T) {
+	file, err := ioutil.TempFile("", "config-*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+	_, _ = file.WriteString("requests:\n  retries : 3\n")
+	_ = file.Close()
+
+	var conf config
+	isPresent, err := configLoadFile(&conf, file.Name())
+	assert.True(t, isPresent)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultMaxRedirects, conf.Requests.MaxRedirects)
+
+	env := getEnv()
+	os.Clearenv()
+	defer restoreEnv(env)
+	envConf, err := configLoadEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, defaultMaxRedirects, envConf.Requests.MaxRedirects)
+
+	_ = os.Setenv("CRAWLER_REQ_MAX_REDIRECTS", "-1")
+	envConf, err = configLoadEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, -1, envConf.Requests.MaxRedirects)
+	os.Clearenv()
+}
+
 func TestConfigLoadFileFail(t *testing.T) {
 	conf := getTestConfig()
 	test := getConfigTest()
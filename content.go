@@ -0,0 +1,198 @@
+package crawl
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"sort"
+	"sync"
+)
+
+const (
+	// simHashBands is the number of bands a fingerprint is split in to find near-duplicate candidates. Fingerprints
+	// within a distance lower than the number of bands share at least a band.
+	simHashBands    = 4
+	simHashBandBits = 64 / simHashBands
+)
+
+// DuplicateCluster is a group of pages with the same content, or near-identical text if not Exact
+type DuplicateCluster struct {
+	URLs  []string `json:"urls"`
+	Exact bool     `json:"exact"`
+}
+
+// simHash returns the SimHash fingerprint of a text given by the number of occurrences of its words. Texts with
+// similar words have fingerprints that differ by few bits.
+func simHash(words map[string]int) uint64 {
+	var weights [64]int
+	for word, count := range words {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(word))
+		sum := h.Sum64()
+		for i := range weights {
+			if sum&(1<<uint(i)) != 0 {
+				weights[i] += count
+			} else {
+				weights[i] -= count
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for i, w := range weights {
+		if w > 0 {
+			fingerprint |= 1 << uint(i)
+		}
+	}
+	return fingerprint
+}
+
+// contentRegistry records the first page seen with each content hash. It's safe for concurrent use, to be shared by
+// workers.
+type contentRegistry struct {
+	mutex sync.Mutex
+	first map[string]string
+}
+
+// newContentRegistry returns an empty contentRegistry
+func newContentRegistry() *contentRegistry {
+	return &contentRegistry{mutex: sync.Mutex{}, first: make(map[string]string)}
+}
+
+// claim registers url as having content hash, and returns the first page that had it, which is url if it's new
+func (r *contentRegistry) claim(hash, url string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if first, ok := r.first[hash]; ok {
+		return first
+	}
+	r.first[hash] = url
+	return url
+}
+
+// duplicateDetector groups pages by content hash, and by SimHash fingerprints within a distance
+type duplicateDetector struct {
+	distance int
+	exact    map[string][]string
+	urls     []string
+	prints   []uint64
+	parents  []int // union-find of near-duplicate pages, by index in urls
+	bands    [simHashBands]map[uint64][]int
+}
+
+// newDuplicateDetector returns a duplicateDetector for near-duplicates within distance bits. The distance can't be
+// more than the number of bands minus one.
+func newDuplicateDetector(distance int) *duplicateDetector {
+	if distance >= simHashBands {
+		distance = simHashBands - 1
+	}
+	d := &duplicateDetector{
+		distance: distance,
+		exact:    make(map[string][]string),
+		urls:     nil,
+		prints:   nil,
+		parents:  nil,
+	}
+	for i := range d.bands {
+		d.bands[i] = make(map[uint64][]int)
+	}
+	return d
+}
+
+// find returns the representative of the cluster of page i
+func (d *duplicateDetector) find(i int) int {
+	for d.parents[i] != i {
+		d.parents[i] = d.parents[d.parents[i]]
+		i = d.parents[i]
+	}
+	return i
+}
+
+// add records the page of url with its content hash and fingerprint, and returns the first page with the same content
+// and the first page with a near-identical text, if any. Pages without text are not compared by fingerprint.
+func (d *duplicateDetector) add(url, hash string, fingerprint uint64, hasText bool) (duplicateOf, nearDuplicateOf string) {
+	if hash != "" {
+		if pages := d.exact[hash]; len(pages) != 0 {
+			duplicateOf = pages[0]
+		}
+		d.exact[hash] = append(d.exact[hash], url)
+	}
+
+	// Exact duplicates are already grouped
+	if !hasText || duplicateOf != "" {
+		return duplicateOf, ""
+	}
+
+	id := len(d.urls)
+	d.urls = append(d.urls, url)
+	d.prints = append(d.prints, fingerprint)
+	d.parents = append(d.parents, id)
+
+	near := -1
+	for b := range d.bands {
+		band := (fingerprint >> uint(b*simHashBandBits)) & (1<<simHashBandBits - 1)
+		for _, other := range d.bands[b][band] {
+			if bits.OnesCount64(fingerprint^d.prints[other]) > d.distance {
+				continue
+			}
+			if near == -1 || other < near {
+				near = other
+			}
+			d.parents[d.find(other)] = d.find(id)
+		}
+		d.bands[b][band] = append(d.bands[b][band], id)
+	}
+
+	if near != -1 {
+		nearDuplicateOf = d.urls[near]
+	}
+	return "", nearDuplicateOf
+}
+
+// clusters returns the groups of exact duplicates and of near-duplicates, of more than one page, sorted
+func (d *duplicateDetector) clusters() []DuplicateCluster {
+	clusters := make([]DuplicateCluster, 0)
+
+	for _, pages := range d.exact {
+		if len(pages) > 1 {
+			clusters = append(clusters, DuplicateCluster{URLs: sortedCopy(pages), Exact: true})
+		}
+	}
+
+	near := make(map[int][]string)
+	for i, url := range d.urls {
+		root := d.find(i)
+		near[root] = append(near[root], url)
+	}
+	for _, pages := range near {
+		if len(pages) > 1 {
+			clusters = append(clusters, DuplicateCluster{URLs: sortedCopy(pages), Exact: false})
+		}
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].URLs[0] < clusters[j].URLs[0] ||
+			clusters[i].URLs[0] == clusters[j].URLs[0] && clusters[i].Exact
+	})
+	return clusters
+}
+
+// detectDuplicates sets the pages result duplicates, if detecting duplicates
+func (c *crawler) detectDuplicates(result *LinkMap) {
+	if c.detector == nil || result.ContentHash == "" {
+		return
+	}
+
+	duplicateOf, nearDuplicateOf := c.detector.add(result.URL, result.ContentHash, result.SimHash, result.SimHash != 0)
+	if result.DuplicateOf == "" {
+		result.DuplicateOf = duplicateOf
+	}
+	result.NearDuplicateOf = nearDuplicateOf
+}
+
+// sortedCopy returns a sorted copy of s
+func sortedCopy(s []string) []string {
+	c := append([]string(nil), s...)
+	sort.Strings(c)
+	return c
+}
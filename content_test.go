@@ -0,0 +1,131 @@
+package crawl
+
+import (
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// words returns the words of text with their number of occurrences
+func words(text string) map[string]int {
+	w := make(map[string]int)
+	countWords(w, text)
+	return w
+}
+
+const article = "The crawler scraps a page for links, follows them and scrapes them in the same fashion. " +
+	"It keeps to a single domain, visits pages in parallel, and avoids loops on already visited links. " +
+	"Results are streamed as they come, or returned all at once when the crawl is over."
+
+func TestSimHash(t *testing.T) {
+	fingerprint := simHash(words(article))
+	assert.Equal(t, fingerprint, simHash(words(strings.ToUpper(article))))
+	assert.Equal(t, uint64(0), simHash(words("")))
+
+	near := simHash(words(article + " Enjoy."))
+	assert.True(t, bits.OnesCount64(fingerprint^near) <= 3, "near-identical texts should have close fingerprints")
+
+	other := simHash(words("Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor " +
+		"incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation."))
+	assert.True(t, bits.OnesCount64(fingerprint^other) > 10, "different texts should have distant fingerprints")
+}
+
+func TestDuplicateDetector(t *testing.T) {
+	d := newDuplicateDetector(3)
+
+	dup, near := d.add("/a", "h1", 0xff00, true)
+	assert.Equal(t, "", dup)
+	assert.Equal(t, "", near)
+
+	dup, _ = d.add("/b", "h1", 0xff00, true)
+	assert.Equal(t, "/a", dup)
+
+	_, near = d.add("/c", "h2", 0xff03, true)
+	assert.Equal(t, "/a", near)
+
+	_, near = d.add("/d", "h3", 0xff0f, true)
+	assert.Equal(t, "/c", near, "near-duplicates are transitive")
+
+	_, near = d.add("/e", "h4", 0x00ff, true)
+	assert.Equal(t, "", near)
+
+	_, near = d.add("/f", "h5", 0, false)
+	assert.Equal(t, "", near, "pages without text are not near-duplicates")
+
+	assert.Equal(t, []DuplicateCluster{
+		{URLs: []string{"/a", "/b"}, Exact: true},
+		{URLs: []string{"/a", "/c", "/d"}, Exact: false},
+	}, d.clusters())
+}
+
+// newDuplicateSite serves the same page under two URLs, the second being linked from the first, and a page with a
+// near-identical text
+func newDuplicateSite() *siteServer {
+	s := &siteServer{hits: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		s.hits[r.URL.Path]++
+		s.mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/":
+			_, _ = fmt.Fprint(w, `<a href="/copy">copy</a><a href="/near">near</a>`)
+		case "/copy", "/print":
+			_, _ = fmt.Fprintf(w, `<p>%s</p><a href="/print">print</a><a href="/more">more</a>`, article)
+		case "/near":
+			_, _ = fmt.Fprintf(w, `<p>%s Enjoy.</p>`, article)
+		default:
+			_, _ = fmt.Fprint(w, `<p>Nothing to see.</p>`)
+		}
+	}))
+	return s
+}
+
+// TestCrawlDuplicates verifies duplicates are reported, and their links not extracted when asked for
+func TestCrawlDuplicates(t *testing.T) {
+	site := newDuplicateSite()
+	defer site.Close()
+
+	syn := newSynchron(0, 1)
+	results := newCrawlerResults(syn)
+	go func() {
+		crawl(site.URL, syn, getTestConfig(), WithDuplicates(3, true))
+		close(syn.results)
+	}()
+
+	pages := make(map[string]*LinkMap)
+	for res := range results.Stream() {
+		pages[strings.TrimPrefix(res.URL, site.URL)] = res
+	}
+
+	copied, printed := pages["/copy"], pages["/print"]
+	assert.Equal(t, copied.URL, printed.DuplicateOf)
+	assert.Equal(t, copied.ContentHash, printed.ContentHash)
+	assert.Empty(t, *printed.Links)
+	assert.NotEqual(t, "", copied.NearDuplicateOf+pages["/near"].NearDuplicateOf)
+	assert.Equal(t, "", pages["/more"].NearDuplicateOf)
+
+	assert.Equal(t, []DuplicateCluster{
+		{URLs: []string{site.URL + "/copy", site.URL + "/print"}, Exact: true},
+		{URLs: []string{site.URL + "/copy", site.URL + "/near"}, Exact: false},
+	}, results.Duplicates())
+}
+
+// TestDuplicateDetection verifies detection can be turned on without overriding the configured settings
+func TestDuplicateDetection(t *testing.T) {
+	conf := getTestConfig()
+	conf.Duplicates.Distance = 5
+	conf.Duplicates.SkipLinks = true
+
+	params, err := newParameters(conf, time.Second, WithDuplicateDetection())
+	assert.NoError(t, err)
+	assert.True(t, params.duplicates)
+	assert.Equal(t, 5, params.nearDistance)
+	assert.True(t, params.skipDuplicates)
+}
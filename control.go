@@ -1,6 +1,7 @@
 package crawl
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"os"
@@ -31,6 +32,10 @@ type CrawlerResults struct {
 	stream      chan *LinkMap // channel streaming results as they arrive
 	exitContext *string       // when the crawler returns, will hold the reason
 	contextLock *sync.Mutex
+	duplicates  *[]DuplicateCluster
+	canonicals  *[]CanonicalIssue
+	bandwidth   *Bandwidth
+	stats       *crawlStats
 }
 
 func newCrawlerResults(syn *synchron) *CrawlerResults {
@@ -39,6 +44,10 @@ func newCrawlerResults(syn *synchron) *CrawlerResults {
 		stream:      syn.results,
 		exitContext: &syn.exitContext,
 		contextLock: &sync.Mutex{},
+		duplicates:  &syn.duplicates,
+		canonicals:  &syn.canonicals,
+		bandwidth:   &syn.bandwidth,
+		stats:       syn.stats,
 	}
 }
 
@@ -56,6 +65,30 @@ func (cr *CrawlerResults) ExitContext() string {
 	return *cr.exitContext
 }
 
+// Duplicates returns the clusters of duplicate and near-duplicate pages, when detecting them with WithDuplicates.
+// It must only be called once the stream is closed.
+func (cr *CrawlerResults) Duplicates() []DuplicateCluster {
+	return *cr.duplicates
+}
+
+// CanonicalIssues returns the problems found with the canonical links of pages, when checking them with WithCanonical.
+// It must only be called once the stream is closed.
+func (cr *CrawlerResults) CanonicalIssues() []CanonicalIssue {
+	return *cr.canonicals
+}
+
+// Bandwidth returns how many bytes of page bodies were downloaded, as received and once decoded.
+// It must only be called once the stream is closed.
+func (cr *CrawlerResults) Bandwidth() Bandwidth {
+	return *cr.bandwidth
+}
+
+// Stats returns a snapshot of the progress of the crawl. It can be called while it runs, and is final once the stream
+// is closed.
+func (cr *CrawlerResults) Stats() Stats {
+	return cr.stats.snapshot()
+}
+
 // timer implements a timeout (should be called as a goroutine)
 func timer(syn *synchron) {
 	defer syn.group.Done()
@@ -127,10 +160,10 @@ func validateInput(domain string, timeout time.Duration) error {
 }
 
 // startCrawling launches the goroutines that constitute the crawler implementation.
-func startCrawling(domain string, syn *synchron, config *config) {
+func startCrawling(domain string, syn *synchron, config *config, options ...Option) {
 	go signalHandler(syn)
 	go timer(syn)
-	go crawl(domain, syn, config)
+	go crawl(domain, syn, config, options...)
 
 	syn.group.Wait()
 
@@ -139,10 +172,14 @@ func startCrawling(domain string, syn *synchron, config *config) {
 }
 
 // StreamLinks returns a channel on which it will report links as they come during the crawling.
-// The caller should range over than channel to continuously retrieve messages. StreamLinks will close that channel
+// The caller should range over than channel to continuously retrieve messages. Pages that could not be retrieved are
+// sent with their Error set and no links. Redirections are followed within the domain's host only, and reported in
+// the LinkMap with their full chain. StreamLinks will close that channel
 // when all encountered links have been visited and none is left, when the deadline on the timeout parameter is reached,
 // or if a SIGINT or SIGTERM signals is received.
-func StreamLinks(domain string, timeout time.Duration) (*CrawlerResults, error) {
+// All requests of a crawl share the same HTTP client, set up by the configuration or given with WithHTTPClient.
+// When recrawling with WithIndex, pages of the previous crawl that were not found are sent last, as removed.
+func StreamLinks(domain string, timeout time.Duration, options ...Option) (*CrawlerResults, error) {
 	// Check env and initialise logging
 	conf, err := initialiseCrawlConfiguration()
 	if err != nil && conf == nil {
@@ -157,21 +194,24 @@ func StreamLinks(domain string, timeout time.Duration) (*CrawlerResults, error)
 	syn := newSynchron(timeout, 3)
 	res := newCrawlerResults(syn)
 
-	go startCrawling(domain, syn, conf)
+	go startCrawling(domain, syn, conf, options...)
 
 	return res, nil
 }
 
 // FetchLinks is a wrapper around StreamLinks and does the same, except it blocks and accumulates all links before
 // returning them to the caller.
-func FetchLinks(domain string, timeout time.Duration) (*CrawlerResults, error) {
-	res, err := StreamLinks(domain, timeout)
+func FetchLinks(domain string, timeout time.Duration, options ...Option) (*CrawlerResults, error) {
+	res, err := StreamLinks(domain, timeout, options...)
 	if err != nil {
 		return nil, err
 	}
 
 	res.links = make([]string, 0, 100) // todo : trade-off here, look if we really need that
 	for linkMap := range res.Stream() {
+		if linkMap.Error != nil {
+			continue
+		}
 		res.links = append(res.links, *linkMap.Links...)
 	}
 
@@ -179,11 +219,17 @@ func FetchLinks(domain string, timeout time.Duration) (*CrawlerResults, error) {
 }
 
 // ScrapLinks returns the links found in the web page pointed to by url
-func ScrapLinks(url string, timeout time.Duration) ([]string, error) {
+func ScrapLinks(url string, timeout time.Duration, options ...Option) ([]string, error) {
 	// Check env and initialise logging
 	conf, err := initialiseCrawlConfiguration()
 	if err != nil && conf == nil {
 		return nil, errors.Wrap(err, exitErrorConf)
 	}
-	return cancellableScrapLinks(url, timeout, nil)
+
+	params, err := newParameters(conf, timeout, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, exitErrorConf)
+	}
+
+	return cancellableScrapLinks(context.Background(), url, params)
 }
@@ -1,6 +1,8 @@
 package crawl
 
 import (
+	"context"
+	"net/http"
 	"net/url"
 	"sync"
 	"time"
@@ -19,68 +21,248 @@ type parameters struct {
 	domain         *url.URL
 	requestTimeout time.Duration
 	maxRetry       int
-}
-
-type linkStates struct {
-	pending map[string]int
-	visited map[string]bool
-	failed  map[string]bool
+	maxRedirects   int
+	client         *http.Client
+	jar            http.CookieJar // set on the client once all options are applied
+	headers        *headers
+	proxies        *proxies
+	stateFile      string
+	stateInterval  time.Duration
+	resume         bool
+	store          StateStore
+	dedup          string
+	falsePositive  float64
+	dedupThreshold int
+	indexFile      string
+	previous       *crawlIndex // pages of the previous crawl, if indexing
+	warcDir        string
+	warcPrefix     string
+	warcMaxSize    int64
+	warc           *warcWriter // archives exchanges, if set
+	mirrorDir      string
+	mirrorRewrite  bool
+	mirror         *mirror // saves pages, if set
+	duplicates     bool
+	nearDistance   int
+	skipDuplicates bool
+	contents       *contentRegistry // shared by workers when skipping the links of duplicates
+	pageInfo       bool
+	ignoreRobots   bool // follow links regardless of robots directives
+	canonical      bool
+	dedupCanonical bool
+	fetcher        Fetcher // if nil, pages are retrieved through client
+	render         RenderFunc
+	extractors     map[string]Extractor // by media type
+	compression    bool
+	maxBodySize    int64 // decoded bytes, 0 for no limit
+	maxBodyRatio   int64 // decoded bytes per received byte, 0 for no limit
+	metrics        Metrics
 }
 
 type task struct {
 	linkStates
-	todo    chan string
-	results chan *LinkMap
+	seen       seenSet        // every link discovered, whatever its state
+	index      *crawlIndex // pages of this crawl, if indexing
+	detector   *duplicateDetector
+	canonicals *canonicalTracker
+	bandwidth  Bandwidth // bytes of the bodies read
+	inFlight   int       // number of workers retrieving a page
+	stats      *crawlStats
+	todo       chan string
+	overflow   int // number of links that didn't fit in todo, waiting for room in the store's queue
+	results    chan *LinkMap
 }
 
 type workers struct {
 	workerSync sync.WaitGroup
-	workerStop chan struct{}
+	workerCtx  context.Context    // cancelled when workers must stop
+	workerStop context.CancelFunc // cancels all in-flight requests
 }
 
-// LinkMap holds the links of the web page pointed to by url, of the same host as the url
+// LinkMap holds the links of the web page pointed to by url, of the same host as the url.
+// If the page was redirected, FinalURL is where it was retrieved from, links are resolved against it,
+// and Redirects holds every hop of the chain.
+// When recrawling with an index, Change tells how the page changed since the previous crawl, and pages that were not
+// modified have a 304 Status and the Links found by the previous crawl.
+// Depth is the number of links followed from the domain to reach the page.
+// ContentHash is the hex encoded SHA-256 of the body of successfully retrieved pages, and SimHash a fingerprint of
+// their text, 0 if they have none. When detecting duplicates, DuplicateOf is the first page found with the same
+// content, and NearDuplicateOf the first one with a near-identical text.
+// When extracting page metadata, Info holds that of successfully retrieved pages that were parsed.
+// Canonical is the URL declared by the canonical link of successfully retrieved pages, if any.
+// Skipped holds the links found on the page that were not followed because of robots directives, and why.
+// TransferSize is the number of bytes of the body that were received, and BodySize that number once decoded.
 type LinkMap struct {
-	URL   string
-	Links *[]string
-	Error error
+	URL             string
+	FinalURL        string
+	Status          int
+	Depth           int
+	Title           string
+	ETag            string
+	LastModified    string
+	Canonical       string
+	ContentHash     string
+	SimHash         uint64
+	DuplicateOf     string
+	NearDuplicateOf string
+	Change          PageChange
+	Info            *PageInfo
+	Redirects       []Redirect
+	Links           *[]string
+	Skipped         []SkippedLink
+	TransferSize    int64
+	BodySize        int64
+	Error           error
+}
+
+// newParameters returns the running parameters set by the configuration, overridden by the options.
+// The timeout applies to each request.
+func newParameters(conf *config, timeout time.Duration, options ...Option) (*parameters, error) {
+	proxy, err := newProxies(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := newHeaders(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parameters{
+		domain:         nil,
+		requestTimeout: timeout,
+		maxRetry:       int(conf.Requests.Retries),
+		maxRedirects:   conf.Requests.MaxRedirects,
+		client:         newHTTPClient(conf, timeout, proxy),
+		jar:            nil,
+		headers:        header,
+		proxies:        proxy,
+		stateFile:      conf.State.File,
+		stateInterval:  conf.State.Interval,
+		resume:         conf.State.Resume,
+		store:          nil,
+		dedup:          conf.Dedup.Filter,
+		falsePositive:  conf.Dedup.FalsePositive,
+		dedupThreshold: int(conf.Dedup.Threshold),
+		indexFile:      conf.State.Index,
+		previous:       nil,
+		warcDir:        conf.Archive.Dir,
+		warcPrefix:     conf.Archive.Prefix,
+		warcMaxSize:    int64(conf.Archive.MaxSize),
+		warc:           nil,
+		mirrorDir:      conf.Mirror.Dir,
+		mirrorRewrite:  conf.Mirror.Rewrite,
+		mirror:         nil,
+		duplicates:     conf.Duplicates.Detect,
+		nearDistance:   int(conf.Duplicates.Distance),
+		skipDuplicates: conf.Duplicates.SkipLinks,
+		contents:       nil,
+		pageInfo:       conf.Extract.PageInfo,
+		ignoreRobots:   conf.Robots.Ignore,
+		canonical:      conf.Canonical.Check,
+		dedupCanonical: conf.Canonical.Dedupe,
+		fetcher:        nil,
+		render:         nil,
+		extractors:     newExtractors(),
+		compression:    conf.Body.Compression,
+		maxBodySize:    int64(conf.Body.MaxSize),
+		maxBodyRatio:   int64(conf.Body.MaxRatio),
+		metrics:        noMetrics{},
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	if p.jar != nil {
+		p.client.Jar = p.jar
+	}
+
+	if p.dedup == dedupBloom {
+		if err := checkFalsePositive(p.falsePositive); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := authenticate(conf, p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
 }
 
 // newCrawler returns an initialised crawler struct
-func newCrawler(domain string, output chan<- *LinkMap, timeout time.Duration, maxRetry int) (*crawler, error) {
+func newCrawler(domain string, output chan<- *LinkMap, params *parameters) (*crawler, error) {
 	dURL, err := url.Parse(domain)
 	if err != nil {
 		return nil, err
 	}
+	normaliseURL(dURL)
+	params.domain = dURL
+	if params.store == nil {
+		params.store = newMemoryStore()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 
-	return &crawler{
+	c := &crawler{
 		task: task{
-			linkStates: linkStates{
-				visited: make(map[string]bool),
-				pending: make(map[string]int),
-				failed:  make(map[string]bool),
-			},
-			todo:    make(chan string, 100),
-			results: make(chan *LinkMap, 100),
+			linkStates: linkStates{store: params.store},
+			seen:       newSeenSet(params.dedup, params.falsePositive, params.dedupThreshold, params.store),
+			index:      nil,
+			detector:   nil,
+			canonicals: nil,
+			bandwidth:  Bandwidth{Pages: 0, Transferred: 0, Decoded: 0},
+			inFlight:   0,
+			stats:      newCrawlStats(),
+			todo:       make(chan string, 100),
+			overflow:   0,
+			results:    make(chan *LinkMap, 100),
 		},
 		workers: workers{
 			workerSync: sync.WaitGroup{},
-			workerStop: make(chan struct{}),
-		},
-		parameters: parameters{
-			domain:         dURL,
-			requestTimeout: timeout,
-			maxRetry:       maxRetry,
+			workerCtx:  ctx,
+			workerStop: cancel,
 		},
-		output: output,
-	}, nil
+		parameters: *params,
+		output:     output,
+	}
+
+	if params.previous != nil {
+		c.index = newCrawlIndex(domain)
+	}
+	if params.duplicates {
+		c.detector = newDuplicateDetector(params.nearDistance)
+	}
+	if params.canonical {
+		c.canonicals = newCanonicalTracker()
+	}
+
+	return c, nil
 }
 
 //  newLinkMap returns an initialised LinkMap struct
 func newLinkMap(url string, links *[]string) *LinkMap {
 	return &LinkMap{
-		URL:   url,
-		Links: links,
-		Error: nil,
+		URL:             url,
+		FinalURL:        "",
+		Status:          0,
+		Depth:           0,
+		Title:           "",
+		ETag:            "",
+		LastModified:    "",
+		Canonical:       "",
+		ContentHash:     "",
+		SimHash:         0,
+		DuplicateOf:     "",
+		NearDuplicateOf: "",
+		Change:          "",
+		Info:            nil,
+		Redirects:       nil,
+		Links:           links,
+		Skipped:         nil,
+		TransferSize:    0,
+		BodySize:        0,
+		Error:           nil,
 	}
 }
 
@@ -90,24 +272,35 @@ func newLinkMap(url string, links *[]string) *LinkMap {
 func (c *crawler) scraper(url string) {
 	defer c.workerSync.Done()
 
+	// Scrap and retrieve links, without following redirections to other hosts
+	log.WithField("url", url).Tracef("Attempting download.")
+	res, err := cancellableScrap(c.workerCtx, url, &c.parameters)
+	if res == nil && err == nil {
+		// We were asked to stop
+		return
+	}
+
 	// LinkMap will hold the links on success, or send as is on error
-	res := newLinkMap(url, nil)
+	if res == nil {
+		res = newLinkMap(url, nil)
+	}
 
-	// Scrap and retrieve links
-	log.WithField("url", url).Tracef("Attempting download.")
-	links, err := cancellableScrapLinks(url, c.requestTimeout, c.workerStop)
 	if err != nil {
 		log.WithField("url", url).Tracef("Download failed : %s", err)
 		res.Error = err
-	} else if links != nil {
+	} else {
+		if len(res.Redirects) != 0 {
+			log.WithField("url", url).Tracef("Followed %d redirects to %s.", len(res.Redirects), res.FinalURL)
+		}
+
 		// Filter links by current domain
-		links = c.filterHost(links)
+		links := c.filterHost(*res.Links)
 		res.Links = &links
 	}
 
 	// Don't send results if we're being asked to stop
 	select {
-	case <-c.workerStop:
+	case <-c.workerCtx.Done():
 		return
 
 	// Enqueue results
@@ -115,12 +308,17 @@ func (c *crawler) scraper(url string) {
 	}
 }
 
+// inScope returns whether the link points to the crawler's host
+func (c *crawler) inScope(link string) bool {
+	linkURL, err := url.Parse(link)
+	return err == nil && linkURL.Host == c.domain.Host
+}
+
 // filterHost filters out links that are different from the crawler's scope
 func (c *crawler) filterHost(links []string) []string {
 	n := 0
 	for _, link := range links {
-		linkURL, _ := url.Parse(link)
-		if linkURL.Host == c.domain.Host {
+		if c.inScope(link) {
 			links[n] = link
 			n++
 		} else {
@@ -130,24 +328,19 @@ func (c *crawler) filterHost(links []string) []string {
 	return links[:n]
 }
 
-// filterLinks filters out links that have already been visited or are in pending treatment
+// filterLinks filters out links that have already been discovered, i.e. that are visited, failed or in pending
+// treatment, and marks the others as discovered
 func (c *crawler) filterLinks(links []string) []string {
 	n := 0
-	// Only keep links that are neither pending or visited
 	for _, link := range links {
-		// If pending, skip
-		if _, ok := c.pending[link]; ok {
-			log.WithField("status", "pending").Tracef("Discarding %s.", link)
-			continue
-		}
-
-		// If visited, skip
-		if _, ok := c.visited[link]; ok {
-			log.WithField("status", "pending").Tracef("Discarding %s.", link)
+		// If already seen, skip
+		if c.seen.has(link) {
+			log.WithField("status", "seen").Tracef("Discarding %s.", link)
 			continue
 		}
 
 		// Keep the link
+		c.seen.add(link)
 		links[n] = link
 		n++
 	}
@@ -158,28 +351,81 @@ func (c *crawler) filterLinks(links []string) []string {
 func (c *crawler) handleResultError(res *LinkMap) {
 	log.WithField("url", res.URL).Tracef("LinkMap returned with error : %s", res.Error)
 
+	// Retrying won't help when redirections loop or go on for too long, or bodies are too large
+	if isRedirectError(res.Error) || isBodyError(res.Error) {
+		c.markFailed(res)
+		log.WithFields(logrus.Fields{
+			"url":       res.URL,
+			"redirects": res.Redirects,
+		}).Errorf("Discarding. %s.", res.Error)
+		return
+	}
+
 	// If we tried to much, mark it as failed
-	if c.pending[res.URL] >= c.maxRetry {
-		c.failed[res.URL] = true
-		delete(c.pending, res.URL)
+	pending := c.pending(res.URL)
+	if pending.attempts >= c.maxRetry {
+		c.markFailed(res)
 		log.WithField("url", res.URL).Errorf("Discarding. Page unreachable after %d attempts.\n", c.maxRetry)
 		return
 	}
 
 	// If we have not reached maximum retries, re-enqueue
-	c.todo <- res.URL
+	c.metrics.Retry()
+	c.stats.update(func(s *Stats) { s.Retries++ })
+	pending.visiting = false
+	c.putPending(res.URL, pending)
+	c.enqueue(res.URL)
+}
+
+// markFailed switches a link from pending to failed, and reports the failure to the caller
+func (c *crawler) markFailed(res *LinkMap) {
+	c.put(FailedSet, res.URL, 1)
+	c.remove(PendingSet, res.URL)
+	c.trackCanonical(res)
+	c.output <- res
+}
+
+// markRedirects marks the intermediate and final URLs of a redirection chain as visited, if they are in scope
+func (c *crawler) markRedirects(result *LinkMap) {
+	for _, hop := range result.Redirects {
+		if c.inScope(hop.Location) {
+			c.put(VisitedSet, hop.Location, 1)
+			c.seen.add(hop.Location)
+		}
+	}
+	if result.FinalURL != "" && c.inScope(result.FinalURL) {
+		c.put(VisitedSet, result.FinalURL, 1)
+		c.seen.add(result.FinalURL)
+	}
 }
 
 // handleResult treats the LinkMap of scraping a page for links
 func (c *crawler) handleResult(result *LinkMap) {
+	result.Depth = c.pending(result.URL).depth
+	c.inFlight--
+	c.bandwidth.add(result)
+	c.stats.update(func(s *Stats) { s.add(result) })
+	if result.TransferSize != 0 {
+		c.metrics.BytesDownloaded(result.TransferSize)
+	}
+	c.checkNotModified(result)
 	if result.Error != nil {
+		c.metrics.Error(errorKind(result.Error))
 		c.handleResultError(result)
 		return
 	}
+	c.metrics.PageFetched(result.Status)
+
+	// Compare to the previous crawl, which may provide the links
+	c.indexPage(result)
+	c.detectDuplicates(result)
+	c.trackCanonical(result)
 
 	// Change state from pending to visited
-	c.visited[result.URL] = true
-	delete(c.pending, result.URL)
+	c.put(VisitedSet, result.URL, 1)
+	c.remove(PendingSet, result.URL)
+	c.markRedirects(result)
+	c.collapseCanonical(result)
 
 	// Filter out already visited links
 	log.WithField("url", result.URL).Tracef("Filtering links.")
@@ -188,7 +434,8 @@ func (c *crawler) handleResult(result *LinkMap) {
 
 	// Add filtered list in queue of links to visit
 	for _, link := range filtered {
-		c.todo <- link
+		c.putPending(link, pendingLink{depth: result.Depth + 1, attempts: 0, visiting: false})
+		c.enqueue(link)
 	}
 
 	// Log LinkMap and send them to caller
@@ -199,54 +446,211 @@ func (c *crawler) handleResult(result *LinkMap) {
 	c.output <- result
 }
 
+// enqueue adds the link to the queue of links to visit. It never blocks : when todo is full, the link waits in the
+// store's queue until there's room.
+func (c *crawler) enqueue(link string) {
+	if c.overflow == 0 {
+		select {
+		case c.todo <- link:
+			return
+		default:
+		}
+	}
+	if c.push(link) {
+		c.overflow++
+	}
+}
+
+// refill moves waiting links from the store's queue to todo, as long as there's room. The crawler is the only one
+// sending to and receiving from todo, so the room can't be taken in between.
+func (c *crawler) refill() {
+	for c.overflow > 0 && len(c.todo) < cap(c.todo) {
+		link, ok := c.pop()
+		if !ok {
+			c.overflow = 0
+			return
+		}
+		c.overflow--
+		c.todo <- link
+	}
+}
+
 // newTask triggers a new visit on a link
 func (c *crawler) newTask(url string) {
 	// Add to pending tasks
-	c.pending[url]++
+	pending := c.pending(url)
+	pending.attempts++
+	pending.visiting = true
+	c.putPending(url, pending)
 
 	// Launch a worker goroutine on that link
+	c.inFlight++
 	c.workerSync.Add(1)
 	go c.scraper(url)
 }
 
+// reportProgress gives the metrics and stats the number of links waiting, being visited, visited and failed
+func (c *crawler) reportProgress() {
+	queued := len(c.todo) + c.overflow
+	c.metrics.QueueLength(queued)
+	c.metrics.InFlight(c.inFlight)
+
+	visited, failed := c.count(VisitedSet), c.count(FailedSet)
+	c.stats.update(func(s *Stats) {
+		s.Visited, s.Failed, s.Pending = visited, failed, queued+c.inFlight
+	})
+}
+
 // checkProgress verifies if there are pages left to scrap or being scraped. Returns false if not.
 func (c *crawler) checkProgress() bool {
-	return len(c.todo) != 0 || len(c.pending) != 0
+	return len(c.todo) != 0 || c.overflow != 0 || c.count(PendingSet) != 0
 }
 
 // initialiseCrawler initialises and returns a new crawler struct
-func initialiseCrawler(domain string, syn *synchron, conf *config) *crawler {
-	c, err := newCrawler(domain, syn.results, conf.Requests.Timeout, int(conf.Requests.Retries))
+func initialiseCrawler(domain string, syn *synchron, conf *config, options ...Option) *crawler {
+	params, err := newParameters(conf, conf.Requests.Timeout, options...)
+	if err != nil {
+		log.WithField("url", domain).Error(err)
+		syn.notifyStop(exitErrorInit)
+		return nil
+	}
+
+	if params.indexFile != "" {
+		if params.previous, err = loadIndex(params.indexFile, domain); err != nil {
+			log.WithField("url", domain).Error(err)
+			syn.notifyStop(exitErrorInit)
+			return nil
+		}
+	}
+
+	// Files are only created once there's something to archive
+	if params.warcDir != "" {
+		if params.warc, err = newWARCWriter(params.warcDir, params.warcPrefix, params.warcMaxSize); err != nil {
+			log.WithField("url", domain).Error(err)
+			syn.notifyStop(exitErrorInit)
+			return nil
+		}
+		params.client = withWARC(params.client, params.warc, params.maxBodySize)
+	}
+
+	if params.mirrorDir != "" {
+		if params.mirror, err = newMirror(params.mirrorDir, params.mirrorRewrite); err != nil {
+			log.WithField("url", domain).Error(err)
+			syn.notifyStop(exitErrorInit)
+			return nil
+		}
+	}
+
+	if params.duplicates && params.skipDuplicates {
+		params.contents = newContentRegistry()
+	}
+
+	if params.store == nil {
+		if params.store, err = newStateStore(conf); err != nil {
+			log.WithField("url", domain).Error(err)
+			syn.notifyStop(exitErrorInit)
+			return nil
+		}
+	}
+
+	c, err := newCrawler(domain, syn.results, params)
+	if err != nil {
+		log.WithField("url", domain).Error(err)
+		_ = params.store.Close()
+		syn.notifyStop(exitErrorInit)
+		return nil
+	}
+
+	// Continue from a saved state, or start from the domain
+	restored, err := c.restoreState()
 	if err != nil {
 		log.WithField("url", domain).Error(err)
+		_ = c.store.Close()
 		syn.notifyStop(exitErrorInit)
 		return nil
 	}
-	c.todo <- c.domain.String()
+	if !restored {
+		c.seen.add(c.domain.String())
+		c.putPending(c.domain.String(), pendingLink{depth: 0, attempts: 0, visiting: false})
+		c.enqueue(c.domain.String())
+	}
+
+	c.stats = syn.stats
+	c.stats.update(func(s *Stats) { s.Start = time.Now() })
+	c.reportProgress()
+
 	return c
 }
 
 // quitCrawler initiates the shutdown process of the crawler
 func (c *crawler) quitCrawler(syn *synchron) {
+	complete := !c.checkProgress()
+
 	// Declare intend to stop
 	syn.notifyStop(exitLinks)
 
-	// Inform launched workers to stop, and wait for them
-	close(c.workerStop)
+	// Inform launched workers to stop, abort their requests, and wait for them
+	c.workerStop()
 	c.workerSync.Wait()
+	c.inFlight = 0
+	c.reportProgress()
+
+	// Save the state, to be able to resume
+	if err := c.saveState(); err != nil {
+		log.WithField("file", c.stateFile).Errorf("Could not save crawl state : %s", err)
+	}
+
+	// Report removed pages, and keep this crawl's pages for the next one
+	if err := c.closeIndex(complete); err != nil {
+		log.WithField("file", c.indexFile).Errorf("Could not save crawl index : %s", err)
+	}
 
-	log.WithField("url", c.domain.String()).Infof("Visited %d links. %d failed.", len(c.visited), len(c.failed))
+	if c.warc != nil {
+		if err := c.warc.Close(); err != nil {
+			log.WithField("dir", c.warcDir).Errorf("Could not close WARC file : %s", err)
+		}
+	}
+
+	if c.mirror != nil {
+		if err := c.mirror.close(); err != nil {
+			log.WithField("dir", c.mirrorDir).Errorf("Could not rewrite mirrored links : %s", err)
+		}
+	}
+
+	if c.detector != nil {
+		syn.duplicates = c.detector.clusters()
+	}
+	if c.canonicals != nil {
+		syn.canonicals = c.canonicals.report()
+	}
+	syn.bandwidth = c.bandwidth
+	c.stats.update(func(s *Stats) { s.End = time.Now() })
+
+	log.WithField("url", c.domain.String()).Infof("Visited %d links. %d failed.",
+		c.count(VisitedSet), c.count(FailedSet))
+
+	if err := c.store.Close(); err != nil {
+		log.Errorf("Could not close state store : %s", err)
+	}
 }
 
 // crawl manages worker goroutines scraping pages and prints results
-func crawl(domain string, syn *synchron, conf *config) {
+func crawl(domain string, syn *synchron, conf *config, options ...Option) {
 	defer syn.group.Done()
 
-	c := initialiseCrawler(domain, syn, conf)
+	c := initialiseCrawler(domain, syn, conf, options...)
 	if c == nil {
 		return
 	}
 	ticker := time.NewTicker(time.Second)
+
+	// Periodically save the crawl state, if asked for
+	var checkpoints <-chan time.Time
+	if c.stateFile != "" && c.stateInterval > 0 {
+		checkpointTicker := time.NewTicker(c.stateInterval)
+		defer checkpointTicker.Stop()
+		checkpoints = checkpointTicker.C
+	}
 loop:
 	for {
 		select {
@@ -257,10 +661,19 @@ loop:
 		// Upon receiving a resulting from a worker scraping a page
 		case result := <-c.results:
 			c.handleResult(result)
+			c.reportProgress()
 
 		// For every link that is left to visit in the queue
 		case link := <-c.todo:
 			c.newTask(link)
+			c.refill()
+			c.reportProgress()
+
+		// Every checkpoint, save the state
+		case <-checkpoints:
+			if err := c.saveState(); err != nil {
+				log.WithField("file", c.stateFile).Errorf("Could not save crawl state : %s", err)
+			}
 
 		// Every tick, verify if there are jobs or pending tasks left
 		case <-ticker.C:
@@ -1,6 +1,7 @@
 package crawl
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -35,10 +36,16 @@ func getTestConfig() *config {
 	return configGetEmergencyConf()
 }
 
+// getTestParameters returns default running parameters
+func getTestParameters(timeout time.Duration) *parameters {
+	params, _ := newParameters(getTestConfig(), timeout)
+	return params
+}
+
 // TestNewCrawlerFail tests a failing condition for the newCrawler() function
 func TestNewCrawlerFail(t *testing.T) {
 	test := getTestData()
-	_, err := newCrawler(test.urlBad, test.syn.results, test.timeout, 3)
+	_, err := newCrawler(test.urlBad, test.syn.results, getTestParameters(test.timeout))
 	if err == nil {
 		t.Errorf("newCrawler() should fail with invalid domain. URL : '%s'.", test.urlBad)
 	}
@@ -101,7 +108,7 @@ func TestHandleResult(t *testing.T) {
 	badResult := newLinkMap(test.urlBad, nil)
 	badResult.Error = errors.New("this a test error")
 	c.handleResult(badResult)
-	_, visited := c.visited[badResult.URL]
+	visited := c.has(VisitedSet, badResult.URL)
 	if visited {
 		t.Errorf("handleResult() should not mark a failing URL as visited.")
 	}
@@ -118,17 +125,20 @@ func TestHandleResultError(t *testing.T) {
 	badResult.Error = errors.New("this a test error")
 
 	// Test case we re-enqueue the result
-	c.pending[badResult.URL] = c.maxRetry - 1
+	c.put(PendingSet, badResult.URL, c.maxRetry-1)
 	c.handleResultError(badResult)
-	if c.failed[badResult.URL] {
+	if c.has(FailedSet, badResult.URL) {
 		t.Error("URL retries have not hit the maximum, should be marked as failed.")
 	}
 
-	// Test case we decide to mark a URL as failed
-	c.pending[badResult.URL] = c.maxRetry
-	c.handleResultError(badResult)
-	_, failed := c.failed[badResult.URL]
-	_, pending := c.pending[badResult.URL]
+	// Test case we decide to mark a URL as failed, which is reported to the caller
+	c.put(PendingSet, badResult.URL, c.maxRetry)
+	go c.handleResultError(badResult)
+	if reported := <-test.syn.results; reported != badResult {
+		t.Error("HandleResultError should report failed URLs on the output.")
+	}
+	failed := c.has(FailedSet, badResult.URL)
+	pending := c.has(PendingSet, badResult.URL)
 	if pending || !failed {
 		t.Error("HandleResultError doesn't correctly switch the URL from pending to failed.")
 	}
@@ -137,15 +147,16 @@ func TestHandleResultError(t *testing.T) {
 // TestCancellableScrapLinksFail tests failing conditions for the download function
 func TestCancellableScrapLinksFail(t *testing.T) {
 	test := getTestData()
+	params := getTestParameters(test.timeout)
 
 	// Should fail on request building
-	_, err := cancellableScrapLinks(test.urlBad, test.timeout, nil)
+	_, err := cancellableScrapLinks(context.Background(), test.urlBad, params)
 	if err == nil {
 		t.Errorf("cancellableScrapLinks() should fail on invalid link. URL : '%s'", test.urlBad)
 	}
 
 	// Should fail on request execution due to timeout
-	_, err = cancellableScrapLinks(test.urlTimeout, test.timeout, nil)
+	_, err = cancellableScrapLinks(context.Background(), test.urlTimeout, params)
 	if err == nil {
 		t.Errorf("cancellableScrapLinks() should fail on timeout. Timeout : '%s'", test.timeout)
 	}
@@ -154,33 +165,57 @@ func TestCancellableScrapLinksFail(t *testing.T) {
 // TestCancellableScrapLinksSuccess verifies the function behaves appropriately on success cases
 func TestCancellableScrapLinksSuccess(t *testing.T) {
 	test := getTestData()
+	params := getTestParameters(test.timeout)
 
 	// Should return immediately because stop is requested
-	stop := make(chan struct{})
-	close(stop)
-	res, err := cancellableScrapLinks(test.urlValid, test.timeout, stop)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err := cancellableScrapLinks(ctx, test.urlValid, params)
 	if err != nil || res != nil {
 		t.Error("cancellableScrapLinks() should return nil only when stop is requested.")
 	}
 
 	// Should return nothing when stop is requested
-	stop = make(chan struct{})
+	ctx, cancel = context.WithCancel(context.Background())
 	cancelWait := 50 * time.Millisecond
 	go func() {
 		time.Sleep(cancelWait)
-		close(stop)
+		cancel()
 	}()
 
-	res, err = cancellableScrapLinks(test.urlTimeout, test.timeout, stop)
+	res, err = cancellableScrapLinks(ctx, test.urlTimeout, params)
 	if err != nil || res != nil {
 		t.Errorf("cancellableScrapLinks() should return nil only when stop is requested : %s", err)
 	}
 
 	// Should return expected result
-	res, err = cancellableScrapLinks(test.urlValid, test.timeout, nil)
+	res, err = cancellableScrapLinks(context.Background(), test.urlValid, params)
 	if err != nil {
 		t.Errorf("cancellableScrapLinks() should not return an error and return expected result : %s", err)
 	} else {
 		assert.ElementsMatch(t, test.expectedLinks, res)
 	}
 }
+
+// TestCrawlDepth verifies pages are reported with the number of links followed from the domain to reach them
+func TestCrawlDepth(t *testing.T) {
+	site := newSiteServer(map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/b", "/c"},
+		"/c": {"/d"},
+	})
+	defer site.Close()
+
+	depths := make(map[string]int)
+	for _, res := range runCrawl(site.URL, getTestConfig()) {
+		depths[res.URL] = res.Depth
+	}
+
+	assert.Equal(t, map[string]int{
+		site.URL:        0,
+		site.URL + "/a": 1,
+		site.URL + "/b": 1,
+		site.URL + "/c": 2,
+		site.URL + "/d": 3,
+	}, depths)
+}
@@ -0,0 +1,206 @@
+package crawl
+
+import (
+	"net/http"
+	"sort"
+)
+
+// StatusChange is a page whose status code changed between two crawls
+type StatusChange struct {
+	URL    string `json:"url"`
+	Before int    `json:"before"`
+	After  int    `json:"after"`
+}
+
+// TitleChange is a page whose title changed between two crawls
+type TitleChange struct {
+	URL    string `json:"url"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// RedirectChange is a page whose redirection chain changed between two crawls
+type RedirectChange struct {
+	URL    string     `json:"url"`
+	Before []Redirect `json:"before"`
+	After  []Redirect `json:"after"`
+}
+
+// BrokenLink is a link to a page answering with an error status
+type BrokenLink struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Status int    `json:"status"`
+}
+
+// Link is an edge from a page to another
+type Link struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// CrawlDiff holds what changed on a site between two crawls. Every list is sorted.
+type CrawlDiff struct {
+	Added            []string         `json:"added"`             // pages found only by the second crawl
+	Removed          []string         `json:"removed"`           // pages found only by the first crawl
+	StatusChanged    []StatusChange   `json:"status_changed"`    // pages whose status code changed
+	TitleChanged     []TitleChange    `json:"title_changed"`     // pages whose title changed
+	RedirectsChanged []RedirectChange `json:"redirects_changed"` // pages whose redirection chain changed
+	NewlyBroken      []BrokenLink     `json:"newly_broken"`      // links that were not broken in the first crawl
+	LinksAdded       []Link           `json:"links_added"`       // links found only by the second crawl
+	LinksRemoved     []Link           `json:"links_removed"`     // links found only by the first crawl
+}
+
+// Empty returns whether nothing changed between the two crawls
+func (d *CrawlDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.StatusChanged) == 0 && len(d.TitleChanged) == 0 &&
+		len(d.RedirectsChanged) == 0 && len(d.NewlyBroken) == 0 && len(d.LinksAdded) == 0 &&
+		len(d.LinksRemoved) == 0
+}
+
+// DiffCrawls compares two crawls of a site, saved in index files with WithIndex, and returns what changed from the
+// first to the second.
+func DiffCrawls(before, after string) (*CrawlDiff, error) {
+	b, err := readIndex(before)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := readIndex(after)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffIndexes(b, a), nil
+}
+
+// diffIndexes returns what changed from the before index to the after index
+func diffIndexes(before, after *crawlIndex) *CrawlDiff {
+	diff := &CrawlDiff{
+		Added:            []string{},
+		Removed:          []string{},
+		StatusChanged:    []StatusChange{},
+		TitleChanged:     []TitleChange{},
+		RedirectsChanged: []RedirectChange{},
+		NewlyBroken:      []BrokenLink{},
+		LinksAdded:       []Link{},
+		LinksRemoved:     []Link{},
+	}
+
+	for url, b := range before.Pages {
+		if after.page(url) == nil {
+			diff.Removed = append(diff.Removed, url)
+			diff.LinksRemoved = append(diff.LinksRemoved, edges(url, b.Links, nil)...)
+		}
+	}
+
+	for url, a := range after.Pages {
+		b := before.page(url)
+		if b == nil {
+			diff.Added = append(diff.Added, url)
+			diff.LinksAdded = append(diff.LinksAdded, edges(url, a.Links, nil)...)
+			diff.NewlyBroken = append(diff.NewlyBroken, newlyBroken(url, a.Links, before, after)...)
+			continue
+		}
+
+		if b.Status != a.Status {
+			diff.StatusChanged = append(diff.StatusChanged, StatusChange{URL: url, Before: b.Status, After: a.Status})
+		}
+		if b.Title != a.Title {
+			diff.TitleChanged = append(diff.TitleChanged, TitleChange{URL: url, Before: b.Title, After: a.Title})
+		}
+		if !sameRedirects(b.Redirects, a.Redirects) {
+			diff.RedirectsChanged = append(diff.RedirectsChanged,
+				RedirectChange{URL: url, Before: b.Redirects, After: a.Redirects})
+		}
+
+		diff.LinksAdded = append(diff.LinksAdded, edges(url, a.Links, b.Links)...)
+		diff.LinksRemoved = append(diff.LinksRemoved, edges(url, b.Links, a.Links)...)
+		diff.NewlyBroken = append(diff.NewlyBroken, newlyBroken(url, a.Links, before, after)...)
+	}
+
+	diff.sort()
+	return diff
+}
+
+// edges returns the links from page to links that are not in except
+func edges(page string, links, except []string) []Link {
+	excluded := make(map[string]bool, len(except))
+	for _, link := range except {
+		excluded[link] = true
+	}
+
+	var e []Link
+	for _, link := range links {
+		if !excluded[link] {
+			e = append(e, Link{From: page, To: link})
+		}
+	}
+	return e
+}
+
+// isBroken returns whether the page of url in index answered with an error status
+func isBroken(index *crawlIndex, url string) bool {
+	page := index.page(url)
+	return page != nil && page.Status >= http.StatusBadRequest
+}
+
+// newlyBroken returns the links from page that are broken in after, and were not in before, either because the link
+// or the target page did not exist, or because the target page was fine
+func newlyBroken(page string, links []string, before, after *crawlIndex) []BrokenLink {
+	var broken []BrokenLink
+	for _, link := range links {
+		if !isBroken(after, link) {
+			continue
+		}
+		if b := before.page(page); b != nil && containsLink(b.Links, link) && isBroken(before, link) {
+			continue
+		}
+		broken = append(broken, BrokenLink{From: page, To: link, Status: after.page(link).Status})
+	}
+	return broken
+}
+
+// containsLink returns whether the sorted links contain link
+func containsLink(links []string, link string) bool {
+	i := sort.SearchStrings(links, link)
+	return i < len(links) && links[i] == link
+}
+
+// sameRedirects returns whether both redirection chains are the same
+func sameRedirects(a, b []Redirect) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sort sorts all lists of the diff, by URL then link target
+func (d *CrawlDiff) sort() {
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.StatusChanged, func(i, j int) bool { return d.StatusChanged[i].URL < d.StatusChanged[j].URL })
+	sort.Slice(d.TitleChanged, func(i, j int) bool { return d.TitleChanged[i].URL < d.TitleChanged[j].URL })
+	sort.Slice(d.RedirectsChanged, func(i, j int) bool {
+		return d.RedirectsChanged[i].URL < d.RedirectsChanged[j].URL
+	})
+	sortLinks := func(from, to func(int) string) func(i, j int) bool {
+		return func(i, j int) bool {
+			return from(i) < from(j) || from(i) == from(j) && to(i) < to(j)
+		}
+	}
+	sort.Slice(d.NewlyBroken, sortLinks(
+		func(i int) string { return d.NewlyBroken[i].From },
+		func(i int) string { return d.NewlyBroken[i].To }))
+	sort.Slice(d.LinksAdded, sortLinks(
+		func(i int) string { return d.LinksAdded[i].From },
+		func(i int) string { return d.LinksAdded[i].To }))
+	sort.Slice(d.LinksRemoved, sortLinks(
+		func(i int) string { return d.LinksRemoved[i].From },
+		func(i int) string { return d.LinksRemoved[i].To }))
+}
@@ -0,0 +1,82 @@
+package crawl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeIndex saves index to a file in dir, and returns its path
+func writeIndex(t *testing.T, dir, name string, index *crawlIndex) string {
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestDiffCrawls(t *testing.T) {
+	file, remove := tempStateFile(t)
+	defer remove()
+	dir := filepath.Dir(file)
+
+	before := newCrawlIndex("https://example.com")
+	before.Pages = map[string]*pageRecord{
+		"https://example.com":      {Status: 200, Title: "Home", Links: []string{"https://example.com/a", "https://example.com/old"}},
+		"https://example.com/a":    {Status: 200, Title: "A", Links: []string{"https://example.com/b"}},
+		"https://example.com/b":    {Status: 200, Links: []string{"https://example.com/gone"}},
+		"https://example.com/gone": {Status: 404, Links: []string{}},
+		"https://example.com/old":  {Status: 200, Links: []string{}},
+	}
+
+	after := newCrawlIndex("https://example.com")
+	after.Pages = map[string]*pageRecord{
+		"https://example.com": {Status: 200, Title: "Welcome", Links: []string{"https://example.com/a",
+			"https://example.com/new"}},
+		"https://example.com/a": {Status: 200, Title: "A", FinalURL: "https://example.com/a/",
+			Redirects: []Redirect{{URL: "https://example.com/a", Status: 301, Location: "https://example.com/a/"}},
+			Links:     []string{"https://example.com/b", "https://example.com/new"}},
+		"https://example.com/b":    {Status: 500, Links: []string{"https://example.com/gone"}},
+		"https://example.com/gone": {Status: 404, Links: []string{}},
+		"https://example.com/new":  {Status: 200, Links: []string{}},
+	}
+
+	diff, err := DiffCrawls(writeIndex(t, dir, "before.json", before), writeIndex(t, dir, "after.json", after))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"https://example.com/new"}, diff.Added)
+	assert.Equal(t, []string{"https://example.com/old"}, diff.Removed)
+	assert.Equal(t, []StatusChange{{URL: "https://example.com/b", Before: 200, After: 500}}, diff.StatusChanged)
+	assert.Equal(t, []TitleChange{{URL: "https://example.com", Before: "Home", After: "Welcome"}}, diff.TitleChanged)
+	assert.Len(t, diff.RedirectsChanged, 1)
+	assert.Equal(t, "https://example.com/a", diff.RedirectsChanged[0].URL)
+
+	// The link to /gone was already broken, the one to /b is new
+	assert.Equal(t, []BrokenLink{{From: "https://example.com/a", To: "https://example.com/b", Status: 500}},
+		diff.NewlyBroken)
+
+	assert.Equal(t, []Link{
+		{From: "https://example.com", To: "https://example.com/new"},
+		{From: "https://example.com/a", To: "https://example.com/new"},
+	}, diff.LinksAdded)
+	assert.Equal(t, []Link{{From: "https://example.com", To: "https://example.com/old"}}, diff.LinksRemoved)
+	assert.False(t, diff.Empty())
+
+	// A crawl compared to itself has no changes
+	same, err := DiffCrawls(filepath.Join(dir, "after.json"), filepath.Join(dir, "after.json"))
+	assert.NoError(t, err)
+	assert.True(t, same.Empty())
+
+	if _, err := DiffCrawls(filepath.Join(dir, "missing.json"), filepath.Join(dir, "after.json")); err == nil {
+		t.Error("DiffCrawls() should fail on a missing index")
+	}
+}
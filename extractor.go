@@ -0,0 +1,128 @@
+package crawl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+)
+
+// Extractor finds the links of documents of a content type
+type Extractor interface {
+	// Extract returns the links found in body, absolute or relative to origin. On error, the links found until then
+	// are still followed.
+	Extract(origin string, body io.Reader) ([]string, error)
+}
+
+// ExtractorFunc is a function used as an Extractor
+type ExtractorFunc func(origin string, body io.Reader) ([]string, error)
+
+// Extract calls f(origin, body)
+func (f ExtractorFunc) Extract(origin string, body io.Reader) ([]string, error) {
+	return f(origin, body)
+}
+
+// htmlExtractor finds the links of HTML pages. The crawler also gets their title, text and metadata.
+type htmlExtractor struct{}
+
+func (htmlExtractor) Extract(origin string, body io.Reader) ([]string, error) {
+	return extractLinks(origin, body), nil
+}
+
+// Media types of the built-in extractors
+const (
+	mediaHTML    = "text/html"
+	mediaXHTML   = "application/xhtml+xml"
+	mediaCSS     = "text/css"
+	mediaXML     = "application/xml"
+	mediaTextXML = "text/xml"
+	mediaRSS     = "application/rss+xml"
+	mediaAtom    = "application/atom+xml"
+	mediaText    = "text/plain"
+	mediaPDF     = "application/pdf"
+)
+
+// newExtractors returns the built-in extractors by media type
+func newExtractors() map[string]Extractor {
+	return map[string]Extractor{
+		mediaHTML:    htmlExtractor{},
+		mediaXHTML:   htmlExtractor{},
+		mediaCSS:     ExtractorFunc(extractCSS),
+		mediaXML:     ExtractorFunc(extractXML),
+		mediaTextXML: ExtractorFunc(extractXML),
+		mediaRSS:     ExtractorFunc(extractXML),
+		mediaAtom:    ExtractorFunc(extractXML),
+		mediaText:    ExtractorFunc(extractText),
+		mediaPDF:     ExtractorFunc(extractPDF),
+	}
+}
+
+// mediaType returns the media type of a Content-Type header value, in lower case, HTML if it is empty or invalid
+func mediaType(contentType string) string {
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return mediaHTML
+	}
+	return strings.ToLower(media)
+}
+
+// binaryMedia returns whether documents of a media type are never markup, e.g. images
+func binaryMedia(media string) bool {
+	for _, prefix := range []string{"image/", "audio/", "video/", "font/"} {
+		if strings.HasPrefix(media, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLikeMarkup returns whether body starts with a tag, once leading white space is skipped
+func looksLikeMarkup(body *bufio.Reader) bool {
+	start, _ := body.Peek(charsetPeekSize)
+	start = bytes.TrimLeft(bytes.TrimPrefix(start, []byte("\xef\xbb\xbf")), " \t\r\n\f")
+	return len(start) > 0 && start[0] == '<'
+}
+
+// extract returns the content of body, with the extractor registered for the media type of contentType. Documents
+// without a content type are taken for HTML, as are plain text documents and those of unknown types that look like
+// markup, since servers sniffing content types label HTML fragments as text. Text documents are transcoded to UTF-8
+// first. Only the links of documents that are not HTML are extracted, and there are none for other unknown types.
+func (p *parameters) extract(origin, contentType string, body io.Reader) *pageContent {
+	media := mediaType(contentType)
+	if _, ok := p.extractors[media]; media == mediaText || (!ok && !binaryMedia(media)) {
+		buffered := bufio.NewReaderSize(body, charsetPeekSize)
+		if looksLikeMarkup(buffered) {
+			log.WithField("url", origin).Tracef("Reading '%s' body as HTML.", contentType)
+			media = mediaHTML
+		}
+		body = buffered
+	}
+	extractor, ok := p.extractors[media]
+	if !ok {
+		log.WithField("url", origin).Tracef("No extractor for content type '%s'.", contentType)
+		return &pageContent{links: []string{}, nofollow: nil, title: "", words: nil, info: nil}
+	}
+
+	// XML documents declare their own encoding
+	if (strings.HasPrefix(media, "text/") && media != mediaTextXML) || media == mediaXHTML {
+		body = decodeBody(origin, body, contentType)
+	}
+	if _, ok := extractor.(htmlExtractor); ok {
+		return extractPage(origin, body, p.mirrorDir != "")
+	}
+
+	links, err := extractor.Extract(origin, body)
+	if err != nil {
+		log.WithField("url", origin).Warnf("Could not extract all links : %s", err)
+	}
+
+	// Links are sanitised as those of HTML pages
+	found := make(map[string]bool)
+	for _, link := range links {
+		if link, err := sanitiseLink(origin, link, p.mirrorDir != ""); err == nil && link != "" {
+			found[link] = true
+		}
+	}
+	return &pageContent{links: mapToSlice(found), nofollow: nil, title: "", words: nil, info: nil}
+}
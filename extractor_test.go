@@ -0,0 +1,78 @@
+package crawl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExtractByContentType verifies documents are extracted according to their content type
+func TestExtractByContentType(t *testing.T) {
+	params := getTestParameters(time.Second)
+	origin := "https://example.com/dir/doc"
+	extract := func(contentType, body string) []string {
+		links := params.extract(origin, contentType, strings.NewReader(body)).links
+		sort.Strings(links)
+		return links
+	}
+
+	html := `<title>Title</title><a href="/a?x=1">a</a>`
+	assert.Equal(t, []string{"https://example.com/a"}, extract("text/html; charset=utf-8", html))
+	assert.Equal(t, []string{"https://example.com/a"}, extract("", html))
+	assert.Equal(t, "Title", params.extract(origin, "", strings.NewReader(html)).title)
+
+	assert.Equal(t, []string{"https://example.com/dir/b.css", "https://example.com/img.png"},
+		extract("text/css", `@import "b.css"; a { background: url(/img.png#x) }`))
+	assert.Equal(t, []string{"https://example.com/page"},
+		extract("Application/RSS+XML", `<rss><channel><link>https://example.com/page</link></channel></rss>`))
+	assert.Equal(t, []string{"https://example.com/x"}, extract("text/plain", "go to https://example.com/x."))
+	assert.Empty(t, extract("image/png", `<a href="/a">a</a>`))
+
+	// HTML fragments sniffed as text, or of unknown types, are still HTML
+	assert.Equal(t, []string{"https://example.com/a"}, extract("text/plain; charset=utf-8", "\n  "+html))
+	assert.Equal(t, []string{"https://example.com/a"}, extract("application/octet-stream", html))
+	assert.Empty(t, extract("application/octet-stream", "go to https://example.com/x."))
+}
+
+// TestCrawlWithExtractor verifies links of other formats are found with registered extractors
+func TestCrawlWithExtractor(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/items":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprint(w, `{"items": [{"href": "/api/items/1"}, {"href": "/api/items/2"}]}`)
+		case "/api/items/1", "/api/items/2":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprint(w, `{"items": []}`)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = fmt.Fprint(w, `<a href="/api/items">items</a>`)
+		}
+	}))
+	defer site.Close()
+
+	jsonLinks := ExtractorFunc(func(_ string, body io.Reader) ([]string, error) {
+		var doc struct {
+			Items []struct {
+				Href string `json:"href"`
+			} `json:"items"`
+		}
+		err := json.NewDecoder(body).Decode(&doc)
+		links := make([]string, len(doc.Items))
+		for i, item := range doc.Items {
+			links[i] = item.Href
+		}
+		return links, err
+	})
+
+	assert.Len(t, runCrawl(site.URL, getTestConfig()), 2)
+	assert.Len(t, runCrawl(site.URL, getTestConfig(), WithExtractor("application/json", jsonLinks)), 4)
+}
@@ -0,0 +1,86 @@
+package crawl
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+var (
+	// cssURL matches url() values, quoted or not, and @import rules with a plain string
+	cssURL = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^'")\s]+))\s*\)|@import\s+(?:"([^"]*)"|'([^']*)')`)
+
+	// textURL matches absolute http and https URLs in text
+	textURL = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `{}|\\^\[\]]+`)
+)
+
+// extractCSS returns the links of a stylesheet, in url() values and @import rules
+func extractCSS(_ string, body io.Reader) ([]string, error) {
+	css, err := ioutil.ReadAll(body)
+	var links []string
+	for _, match := range cssURL.FindAllSubmatch(css, -1) {
+		for _, group := range match[1:] {
+			if link := string(group); link != "" && !strings.HasPrefix(link, "data:") {
+				links = append(links, link)
+			}
+		}
+	}
+	return links, err
+}
+
+// extractText returns the absolute URLs written in a text, without the punctuation that may follow them
+func extractText(_ string, body io.Reader) ([]string, error) {
+	text, err := ioutil.ReadAll(body)
+	var links []string
+	for _, match := range textURL.FindAll(text, -1) {
+		links = append(links, strings.TrimRight(string(match), ".,;:!?)"))
+	}
+	return links, err
+}
+
+// extractXML returns the links of XML sitemaps, sitemap indexes, and RSS and Atom feeds : the text of loc elements in
+// sitemaps and of link elements in RSS, and the href attribute of link elements and the url attribute of enclosure
+// elements in Atom and RSS.
+func extractXML(_ string, body io.Reader) ([]string, error) {
+	decoder := xml.NewDecoder(body)
+	decoder.Strict = false
+	decoder.CharsetReader = xmlCharsetReader
+
+	var links []string
+	text, inLink := "", false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return links, nil
+		}
+		if err != nil {
+			return links, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "loc", "link":
+				text, inLink = "", true
+			}
+			for _, a := range t.Attr {
+				if (a.Name.Local == "href" && t.Name.Local == "link") || (a.Name.Local == "url" && t.Name.Local == "enclosure") {
+					links = append(links, strings.TrimSpace(a.Value))
+				}
+			}
+		case xml.CharData:
+			if inLink {
+				text += string(t)
+			}
+		case xml.EndElement:
+			if inLink && (t.Name.Local == "loc" || t.Name.Local == "link") {
+				if link := strings.TrimSpace(text); link != "" {
+					links = append(links, link)
+				}
+				inLink = false
+			}
+		}
+	}
+}
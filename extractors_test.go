@@ -0,0 +1,89 @@
+package crawl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExtractCSS verifies links are found in url() values and @import rules
+func TestExtractCSS(t *testing.T) {
+	css := `@import "base.css";
+@import url('print.css') print;
+body { background: url(/img/bg.png) no-repeat; }
+.logo { background-image: url( "data:image/png;base64,iVBOR" ); }
+@font-face { src: url("../fonts/a.woff2") format("woff2"), url(   fonts/b.woff  ); }`
+
+	links, err := extractCSS("https://example.com/css/main.css", strings.NewReader(css))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"base.css", "print.css", "/img/bg.png", "../fonts/a.woff2", "fonts/b.woff"}, links)
+}
+
+// TestExtractText verifies absolute URLs are found in plain text, without trailing punctuation
+func TestExtractText(t *testing.T) {
+	text := "See https://example.com/docs. Or (http://example.com/faq), and <https://example.com/a?b=c>!\n" +
+		"Not ftp://example.com or example.com/page."
+
+	links, err := extractText("https://example.com", strings.NewReader(text))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/docs", "http://example.com/faq", "https://example.com/a?b=c"}, links)
+}
+
+// TestExtractXML verifies links are found in sitemaps and feeds
+func TestExtractXML(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		links []string
+	}{
+		{
+			"sitemap",
+			`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/</loc><lastmod>2020-01-01</lastmod></url>
+  <url><loc>
+    https://example.com/a?x=1&amp;y=2
+  </loc></url>
+</urlset>`,
+			[]string{"https://example.com/", "https://example.com/a?x=1&y=2"},
+		},
+		{
+			"sitemap index",
+			`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://example.com/sitemap-1.xml</loc></sitemap>
+</sitemapindex>`,
+			[]string{"https://example.com/sitemap-1.xml"},
+		},
+		{
+			"rss",
+			`<?xml version="1.0" encoding="ISO-8859-1"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel>
+  <link>https://example.com/blog</link>
+  <atom:link href="https://example.com/feed.xml" rel="self"/>
+  <item><title>Post</title><link>https://example.com/blog/post</link>
+    <enclosure url="https://example.com/post.mp3" type="audio/mpeg" length="1"/></item>
+</channel></rss>`,
+			[]string{"https://example.com/blog", "https://example.com/feed.xml", "https://example.com/blog/post",
+				"https://example.com/post.mp3"},
+		},
+		{
+			"atom",
+			`<feed xmlns="http://www.w3.org/2005/Atom">
+  <link href="https://example.com/"/>
+  <entry><title>Post</title><link rel="alternate" href="/post"/></entry>
+</feed>`,
+			[]string{"https://example.com/", "/post"},
+		},
+	}
+
+	for _, test := range tests {
+		links, err := extractXML("https://example.com", strings.NewReader(test.doc))
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.links, links, test.name)
+	}
+
+	links, err := extractXML("https://example.com", strings.NewReader(`<urlset><url><loc>/a</loc></url><url>`))
+	assert.Error(t, err)
+	assert.Equal(t, []string{"/a"}, links)
+}
@@ -0,0 +1,140 @@
+package crawl
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Fetcher retrieves web pages for the crawler. Fetch sends req, which holds the configured headers and is cancelled
+// when the crawl stops, and returns the response with its Request set to the one the page was finally retrieved with.
+// The crawler closes the response body.
+type Fetcher interface {
+	Fetch(req *http.Request) (*http.Response, error)
+}
+
+// FetcherFunc is a function used as a Fetcher
+type FetcherFunc func(req *http.Request) (*http.Response, error)
+
+// Fetch calls f(req)
+func (f FetcherFunc) Fetch(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// RenderFunc returns the DOM of the page at url once rendered, as HTML, e.g. by a headless browser running its
+// scripts. body is the page as it was downloaded. It must return as soon as ctx is cancelled.
+type RenderFunc func(ctx context.Context, url string, body []byte) ([]byte, error)
+
+// httpFetcher is the default Fetcher, sending requests through the shared client. It asks for compressed bodies, unless
+// compression is disabled or the request has its own Accept-Encoding header, and decodes them within the size limits.
+type httpFetcher struct {
+	client      *http.Client
+	compression bool
+	maxSize     int64
+	maxRatio    int64
+}
+
+func (f *httpFetcher) Fetch(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" {
+		if f.compression {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		} else {
+			req.Header.Set("Accept-Encoding", "identity")
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The body is now the decoded one
+	resp.Body = newDecodedBody(resp, f.maxSize, f.maxRatio)
+	if resp.Header.Get("Content-Encoding") != "" {
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return resp, nil
+}
+
+// renderingFetcher replaces the body of successfully retrieved HTML pages by their rendered DOM
+type renderingFetcher struct {
+	next   Fetcher
+	render RenderFunc
+}
+
+// renderedBody is a rendered DOM, which keeps the sizes of the body it replaced
+type renderedBody struct {
+	io.ReadCloser
+	transferred, decoded int64
+}
+
+func (b *renderedBody) sizes() (int64, int64) {
+	return b.transferred, b.decoded
+}
+
+// isHTML returns whether a Content-Type header value is for an HTML page, which it is assumed to be if empty
+func isHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	media, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (media == "text/html" || media == "application/xhtml+xml")
+}
+
+func (f *renderingFetcher) Fetch(req *http.Request) (*http.Response, error) {
+	resp, err := f.next.Fetch(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 || !isHTML(resp.Header.Get("Content-Type")) {
+		return resp, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not read page to render")
+	}
+
+	url := req.URL.String()
+	if resp.Request != nil {
+		url = resp.Request.URL.String()
+	}
+	dom, err := f.render(req.Context(), url, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not render page")
+	}
+
+	rendered := &renderedBody{ReadCloser: ioutil.NopCloser(bytes.NewReader(dom)), transferred: 0, decoded: 0}
+	if sizer, ok := resp.Body.(bodySizer); ok {
+		rendered.transferred, rendered.decoded = sizer.sizes()
+	}
+	resp.Body = rendered
+	resp.ContentLength = int64(len(dom))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(dom)))
+	return resp, nil
+}
+
+// pageFetcher returns the Fetcher the crawler retrieves pages with : the one given as option or the shared client,
+// rendering pages if asked for
+func (p *parameters) pageFetcher() Fetcher {
+	var f Fetcher = &httpFetcher{
+		client:      p.client,
+		compression: p.compression,
+		maxSize:     p.maxBodySize,
+		maxRatio:    p.maxBodyRatio,
+	}
+	if p.fetcher != nil {
+		f = p.fetcher
+	}
+	if p.render != nil {
+		f = &renderingFetcher{next: f, render: p.render}
+	}
+	return f
+}
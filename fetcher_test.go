@@ -0,0 +1,115 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestIsHTML verifies which content types are rendered
+func TestIsHTML(t *testing.T) {
+	assert.True(t, isHTML(""))
+	assert.True(t, isHTML("text/html; charset=utf-8"))
+	assert.True(t, isHTML("application/xhtml+xml"))
+	assert.False(t, isHTML("image/png"))
+	assert.False(t, isHTML("text/html;;"))
+}
+
+// TestCrawlWithFetcher verifies pages are retrieved with the given fetcher, without network
+func TestCrawlWithFetcher(t *testing.T) {
+	domain := "https://example.com"
+	pages := map[string]string{
+		"/":  `<a href="/a">a</a><a href="/b">b</a>`,
+		"/a": `<a href="/b">b</a>`,
+		"/b": `<p>leaf</p>`,
+	}
+
+	fetcher := FetcherFunc(func(req *http.Request) (*http.Response, error) {
+		path := req.URL.Path
+		if path == "" {
+			path = "/"
+		}
+		body, ok := pages[path]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/html"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+
+	results := runCrawl(domain, getTestConfig(), WithFetcher(fetcher))
+	visited := make([]string, 0, len(results))
+	for _, res := range results {
+		assert.NoError(t, res.Error)
+		assert.Equal(t, res.URL, res.FinalURL)
+		visited = append(visited, res.URL)
+	}
+	assert.ElementsMatch(t, []string{domain, domain + "/a", domain + "/b"}, visited)
+}
+
+// TestCrawlWithRenderer verifies links added by scripts are found on rendered pages, and that only successfully
+// retrieved HTML pages are rendered
+func TestCrawlWithRenderer(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = fmt.Fprint(w, "png")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = fmt.Fprint(w, `<html><body><div id="app"></div><script src="/app.js"></script></body></html>`)
+		}
+	}))
+	defer site.Close()
+
+	var mutex sync.Mutex
+	var rendered []string
+
+	// Pretends to run the page's scripts, which add links depending on the page
+	render := func(ctx context.Context, url string, body []byte) ([]byte, error) {
+		mutex.Lock()
+		rendered = append(rendered, strings.TrimPrefix(url, site.URL))
+		mutex.Unlock()
+
+		dom := strings.Replace(string(body), `<div id="app"></div>`, `<div id="app"><a href="/app">app</a></div>`, 1)
+		if strings.HasSuffix(url, "/app") {
+			dom = strings.Replace(dom, `<div id="app"></div>`, "", 1) + `<a href="/missing">m</a><a href="/logo.png">l</a>`
+		}
+		return []byte(dom), nil
+	}
+
+	results := runCrawl(site.URL, getTestConfig(), WithRenderer(render))
+	assert.Len(t, results, 4)
+	assert.ElementsMatch(t, []string{"", "/app"}, rendered)
+}
+
+// TestRendererError verifies a page that can't be rendered is an error
+func TestRendererError(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `<a href="/a">a</a>`)
+	}))
+	defer site.Close()
+
+	params := getTestParameters(time.Second)
+	WithRenderer(func(ctx context.Context, url string, body []byte) ([]byte, error) {
+		return nil, errors.New("browser crashed")
+	})(params)
+
+	res, err := cancellableScrap(context.Background(), site.URL, params)
+	assert.Error(t, err)
+	assert.Equal(t, site.URL, res.URL)
+}
@@ -0,0 +1,154 @@
+package crawl
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Default values for request headers, used when not configured otherwise
+const (
+	defaultUserAgent      = "crawl/0.0.1 (+https://github.com/bytemare/crawl)"
+	defaultAccept         = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	defaultAcceptLanguage = "en-US,en;q=0.8,*;q=0.5"
+)
+
+// headerSeparator separates header entries in configuration values
+const headerSeparator = "|"
+
+// headers holds the headers sent with every request, and the ones only sent to some hosts
+type headers struct {
+	common http.Header
+	hosts  map[string]http.Header
+}
+
+// newHeaders returns the request headers set by the configuration
+func newHeaders(conf *config) (*headers, error) {
+	common, err := parseHeaders(conf.Requests.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts, err := parseHostHeaders(conf.Requests.HostHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range map[string]string{
+		"User-Agent":      conf.Requests.UserAgent,
+		"Accept":          conf.Requests.Accept,
+		"Accept-Language": conf.Requests.AcceptLanguage,
+	} {
+		if value != "" && common.Get(name) == "" {
+			common.Set(name, value)
+		}
+	}
+
+	return &headers{
+		common: common,
+		hosts:  hosts,
+	}, nil
+}
+
+// ParseHeader returns the name and value of a header given as "Name: value", as in the configuration
+func ParseHeader(header string) (string, string, error) {
+	kv := strings.SplitN(header, ":", 2)
+	name := strings.TrimSpace(kv[0])
+	if len(kv) != 2 || name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", errors.Errorf("Invalid header '%s', expected 'Name: value'", header)
+	}
+	return name, strings.TrimSpace(kv[1]), nil
+}
+
+// parseHeaders returns the headers given as "Name: value" entries separated by headerSeparator
+func parseHeaders(list string) (http.Header, error) {
+	h := make(http.Header)
+	for _, entry := range strings.Split(list, headerSeparator) {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, value, err := ParseHeader(entry)
+		if err != nil {
+			return nil, err
+		}
+		h.Add(name, value)
+	}
+	return h, nil
+}
+
+// ParseHostHeader returns the host, name and value of a header only sent to a host, given as "host=Name: value", as
+// in the configuration
+func ParseHostHeader(entry string) (string, string, string, error) {
+	hv := strings.SplitN(entry, "=", 2)
+	host := strings.TrimSpace(hv[0])
+	if len(hv) != 2 || host == "" {
+		return "", "", "", errors.Errorf("Invalid host header '%s', expected 'host=Name: value'", entry)
+	}
+	name, value, err := ParseHeader(hv[1])
+	if err != nil {
+		return "", "", "", err
+	}
+	return host, name, value, nil
+}
+
+// parseHostHeaders returns the per host headers given as "host=Name: value" entries separated by headerSeparator
+func parseHostHeaders(list string) (map[string]http.Header, error) {
+	hosts := make(map[string]http.Header)
+	for _, entry := range strings.Split(list, headerSeparator) {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		host, name, value, err := ParseHostHeader(entry)
+		if err != nil {
+			return nil, err
+		}
+		if hosts[host] == nil {
+			hosts[host] = make(http.Header)
+		}
+		hosts[host].Add(name, value)
+	}
+	return hosts, nil
+}
+
+// set sets name to value for every request
+func (h *headers) set(name, value string) {
+	h.common.Set(name, value)
+}
+
+// setHost sets name to value for requests to host only
+func (h *headers) setHost(host, name, value string) {
+	if h.hosts[host] == nil {
+		h.hosts[host] = make(http.Header)
+	}
+	h.hosts[host].Set(name, value)
+}
+
+// forHost returns the headers to send in a request to host, given without port.
+// Headers set for the host override the common ones.
+func (h *headers) forHost(host string) http.Header {
+	header := make(http.Header, len(h.common))
+	for name, values := range h.common {
+		header[name] = append([]string(nil), values...)
+	}
+	for name, values := range h.hosts[host] {
+		header[name] = append([]string(nil), values...)
+	}
+	return header
+}
+
+// redirect updates the headers of a redirected request when it goes to another host : the previous host's headers are
+// replaced by the new host's, but the sensitive headers the http.Client dropped are not sent again.
+func (h *headers) redirect(req, previous *http.Request) {
+	if req.URL.Hostname() == previous.URL.Hostname() {
+		return
+	}
+
+	header := h.forHost(req.URL.Hostname())
+	for name := range header {
+		if _, ok := req.Header[name]; !ok && previous.Header.Get(name) != "" {
+			header.Del(name)
+		}
+	}
+	req.Header = header
+}
@@ -0,0 +1,102 @@
+package crawl
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseHeadersFail tests invalid header specifications
+func TestParseHeadersFail(t *testing.T) {
+	for _, invalid := range []string{"X-Missing-Colon", ": value", "X Space: value", "X-Ok: 1|bad"} {
+		if _, err := parseHeaders(invalid); err == nil {
+			t.Errorf("parseHeaders() should fail on '%s'.", invalid)
+		}
+	}
+
+	for _, invalid := range []string{"X-Missing-Host: value", "=X-Empty-Host: value", "example.com=bad"} {
+		if _, err := parseHostHeaders(invalid); err == nil {
+			t.Errorf("parseHostHeaders() should fail on '%s'.", invalid)
+		}
+	}
+
+	conf := getTestConfig()
+	conf.Requests.HostHeaders = "invalid"
+	if _, err := newParameters(conf, time.Second); err == nil {
+		t.Error("newParameters() should fail on invalid headers.")
+	}
+}
+
+// TestParseHostHeader verifies host headers are parsed as in the configuration
+func TestParseHostHeader(t *testing.T) {
+	host, name, value, err := ParseHostHeader(" example.com = X-Token : a=b ")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "X-Token", "a=b"}, []string{host, name, value})
+
+	_, _, _, err = ParseHostHeader("example.com=X Token: a")
+	assert.Error(t, err)
+}
+
+// TestHeadersForHost verifies defaults, configured headers, options and per host overrides
+func TestHeadersForHost(t *testing.T) {
+	conf := getTestConfig()
+	conf.Requests.Headers = "X-Team: seo | From: webmaster@example.com"
+	conf.Requests.HostHeaders = "example.com=X-Team: blog|example.com=X-Token: abc"
+
+	params, err := newParameters(conf, time.Second, WithUserAgent("tester/1.0"), WithHeader("X-Run", "42"),
+		WithHostHeader("example.org", "X-Token", "def"))
+	if err != nil {
+		t.Fatalf("newParameters() should not fail on valid headers : %s", err)
+	}
+
+	common := params.headers.forHost("bytema.re")
+	assert.Equal(t, "tester/1.0", common.Get("User-Agent"))
+	assert.Equal(t, defaultAccept, common.Get("Accept"))
+	assert.Equal(t, defaultAcceptLanguage, common.Get("Accept-Language"))
+	assert.Equal(t, "seo", common.Get("X-Team"))
+	assert.Equal(t, "webmaster@example.com", common.Get("From"))
+	assert.Equal(t, "42", common.Get("X-Run"))
+	assert.Empty(t, common.Get("X-Token"))
+
+	host := params.headers.forHost("example.com")
+	assert.Equal(t, "blog", host.Get("X-Team"))
+	assert.Equal(t, "abc", host.Get("X-Token"))
+	assert.Equal(t, "def", params.headers.forHost("example.org").Get("X-Token"))
+}
+
+// TestDownloadHeaders verifies the headers are sent, and replaced when redirected to another host
+func TestDownloadHeaders(t *testing.T) {
+	received := make(chan http.Header, 2)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+	}))
+	defer target.Close()
+
+	// Serve on another host name than target, which is reached on 127.0.0.1
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer origin.Close()
+	_, port, _ := net.SplitHostPort(origin.Listener.Addr().String())
+	originURL := "http://localhost:" + port
+
+	params := getTestParameters(3 * time.Second)
+	WithUserAgent("tester/1.0")(params)
+	WithHostHeader("localhost", "X-Token", "secret")(params)
+
+	if _, err := cancellableScrap(context.Background(), originURL, params); err != nil {
+		t.Fatalf("cancellableScrap() should not fail : %s", err)
+	}
+
+	first, second := <-received, <-received
+	assert.Equal(t, "tester/1.0", first.Get("User-Agent"))
+	assert.Equal(t, "secret", first.Get("X-Token"))
+	assert.Equal(t, "tester/1.0", second.Get("User-Agent"))
+	assert.Empty(t, second.Get("X-Token"), "host headers should not be sent to another host")
+}
@@ -0,0 +1,239 @@
+package crawl
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PageChange tells how a page changed since the previous crawl of the same domain
+type PageChange string
+
+// A page is new if it was not in the previous crawl, and removed if it was but can't be found anymore
+const (
+	PageNew       PageChange = "new"
+	PageChanged   PageChange = "changed"
+	PageUnchanged PageChange = "unchanged"
+	PageRemoved   PageChange = "removed"
+)
+
+// pageRecord is what is kept of a page between two crawls
+type pageRecord struct {
+	FinalURL     string     `json:"final_url,omitempty"`
+	Status       int        `json:"status"`
+	Title        string     `json:"title,omitempty"`
+	ETag         string     `json:"etag,omitempty"`
+	LastModified string     `json:"last_modified,omitempty"`
+	Redirects    []Redirect `json:"redirects,omitempty"`
+	Links        []string   `json:"links"`
+}
+
+// crawlIndex holds the pages found by a crawl, indexed by their URL, to only download what changed on the next crawl
+type crawlIndex struct {
+	Domain string                 `json:"domain"`
+	Saved  time.Time              `json:"saved"`
+	Pages  map[string]*pageRecord `json:"pages"`
+}
+
+// newCrawlIndex returns an empty index for domain
+func newCrawlIndex(domain string) *crawlIndex {
+	return &crawlIndex{
+		Domain: domain,
+		Saved:  time.Time{},
+		Pages:  make(map[string]*pageRecord),
+	}
+}
+
+// newPageRecord returns the record of the page in res. Its links must already be filtered by host.
+func newPageRecord(res *LinkMap) *pageRecord {
+	links := make([]string, 0)
+	if res.Links != nil {
+		links = append(links, *res.Links...)
+		sort.Strings(links)
+	}
+
+	return &pageRecord{
+		FinalURL:     res.FinalURL,
+		Status:       res.Status,
+		Title:        res.Title,
+		ETag:         res.ETag,
+		LastModified: res.LastModified,
+		Redirects:    res.Redirects,
+		Links:        links,
+	}
+}
+
+// sameAs returns whether both records are of the same version of a page. Validators are trusted when both records
+// have them, and the outcome of the request is compared otherwise.
+func (r *pageRecord) sameAs(other *pageRecord) bool {
+	if r.ETag != "" && other.ETag != "" {
+		return r.ETag == other.ETag
+	}
+	if r.LastModified != "" && other.LastModified != "" {
+		return r.LastModified == other.LastModified
+	}
+	if r.Status != other.Status || r.FinalURL != other.FinalURL || len(r.Links) != len(other.Links) {
+		return false
+	}
+	for i, link := range r.Links {
+		if other.Links[i] != link {
+			return false
+		}
+	}
+	return true
+}
+
+// page returns the record of url, or nil if there's none. It is safe to call on a nil index.
+func (i *crawlIndex) page(url string) *pageRecord {
+	if i == nil {
+		return nil
+	}
+	return i.Pages[url]
+}
+
+// setConditionalHeaders makes req conditional on the page having changed since record was taken, if possible
+func setConditionalHeaders(req *http.Request, record *pageRecord) {
+	if record == nil {
+		return
+	}
+	if record.ETag != "" {
+		req.Header.Set("If-None-Match", record.ETag)
+	}
+	if record.LastModified != "" {
+		req.Header.Set("If-Modified-Since", record.LastModified)
+	}
+}
+
+// readIndex reads a crawl index from file
+func readIndex(file string) (*crawlIndex, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not read crawl index '%s'", file)
+	}
+
+	var index crawlIndex
+	if err = json.Unmarshal(data, &index); err != nil {
+		return nil, errors.Wrapf(err, "Invalid crawl index file '%s'", file)
+	}
+	if index.Pages == nil {
+		index.Pages = make(map[string]*pageRecord)
+	}
+
+	return &index, nil
+}
+
+// loadIndex reads the crawl index of domain from file. If the file does not exist, the index is empty.
+func loadIndex(file, domain string) (*crawlIndex, error) {
+	index, err := readIndex(file)
+	if os.IsNotExist(errors.Cause(err)) {
+		log.WithField("file", file).Info("No previous crawl index, all pages are new.")
+		return newCrawlIndex(domain), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if index.Domain != domain {
+		return nil, errors.Errorf("Crawl index in '%s' is for '%s', not '%s'", file, index.Domain, domain)
+	}
+
+	return index, nil
+}
+
+// errUnknownNotModified is set on a page reported as not modified that the previous crawl didn't index
+var errUnknownNotModified = errors.New("page not modified, but unknown to the previous crawl")
+
+// checkNotModified sets an error on a result not modified since a previous crawl that doesn't know the page, as there
+// are no links to reuse. The page is then retried, unconditionally since there's no record to compare to.
+func (c *crawler) checkNotModified(result *LinkMap) {
+	if result.Error == nil && result.Status == http.StatusNotModified && c.previous.page(result.URL) == nil {
+		result.Error = errUnknownNotModified
+	}
+}
+
+// indexPage compares the page in result to the previous crawl, sets how it changed, and records it for the next
+// crawl. When the page was not modified, the links found in the previous crawl are reused.
+func (c *crawler) indexPage(result *LinkMap) {
+	if c.index == nil {
+		return
+	}
+	previous := c.previous.page(result.URL)
+
+	if result.Status == http.StatusNotModified && previous != nil {
+		links := append([]string(nil), previous.Links...)
+		result.Links = &links
+		result.Title = previous.Title
+		result.Change = PageUnchanged
+		c.index.Pages[result.URL] = previous
+		return
+	}
+
+	record := newPageRecord(result)
+	c.index.Pages[result.URL] = record
+
+	// Pages that can't be found anymore are kept as broken
+	if result.Status >= http.StatusBadRequest {
+		if previous != nil && previous.Status < http.StatusBadRequest {
+			result.Change = PageRemoved
+		}
+		return
+	}
+
+	switch {
+	case previous == nil:
+		result.Change = PageNew
+	case previous.sameAs(record):
+		result.Change = PageUnchanged
+	default:
+		result.Change = PageChanged
+	}
+}
+
+// closeIndex reports the pages of the previous crawl that were not found by this one as removed, and saves the index
+// of this crawl. If the crawl is not complete, or a page failed, the previous records of the pages that were not
+// visited are kept.
+func (c *crawler) closeIndex(complete bool) error {
+	if c.index == nil {
+		return nil
+	}
+
+	for url, record := range c.previous.Pages {
+		if _, ok := c.index.Pages[url]; ok || c.has(VisitedSet, url) {
+			continue
+		}
+		if !complete || c.has(FailedSet, url) {
+			c.index.Pages[url] = record
+			continue
+		}
+		if record.Status >= http.StatusBadRequest {
+			// It was already gone
+			continue
+		}
+		removed := newLinkMap(url, &[]string{})
+		removed.Change = PageRemoved
+		c.output <- removed
+	}
+
+	c.index.Saved = time.Now()
+	data, err := json.Marshal(c.index)
+	if err != nil {
+		return errors.Wrap(err, "Could not encode crawl index")
+	}
+
+	err = writeFileAtomic(c.indexFile, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "Could not write crawl index")
+	}
+
+	log.WithField("file", c.indexFile).Infof("Saved crawl index of %d pages.", len(c.index.Pages))
+	return nil
+}
@@ -0,0 +1,195 @@
+package crawl
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// versionedSite serves pages with an ETag of their version, and answers conditional requests
+type versionedSite struct {
+	*httptest.Server
+	mutex       sync.Mutex
+	pages       map[string][]string
+	versions    map[string]int
+	notModified int
+}
+
+func newVersionedSite(pages map[string][]string) *versionedSite {
+	s := &versionedSite{pages: pages, versions: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		links, ok := s.pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		etag := fmt.Sprintf(`"v%d"`, s.versions[r.URL.Path])
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			s.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		_, _ = fmt.Fprint(w, "<html><body>")
+		for _, link := range links {
+			_, _ = fmt.Fprintf(w, `<a href="%s">%s</a>`, link, link)
+		}
+		_, _ = fmt.Fprint(w, "</body></html>")
+	}))
+	return s
+}
+
+// update changes the site while it's not being crawled
+func (s *versionedSite) update(f func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f()
+}
+
+// changes returns how each page changed, by path
+func changes(site string, results []*LinkMap) map[string]PageChange {
+	c := make(map[string]PageChange)
+	for _, res := range results {
+		c[strings.TrimPrefix(res.URL, site)] = res.Change
+	}
+	return c
+}
+
+// TestCrawlIndex verifies a recrawl only downloads changed pages, and reports how pages changed
+func TestCrawlIndex(t *testing.T) {
+	site := newVersionedSite(map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/c"},
+		"/b": {},
+		"/c": {},
+	})
+	defer site.Close()
+	file, remove := tempStateFile(t)
+	defer remove()
+	conf := getTestConfig()
+
+	// First crawl
+	first := runCrawl(site.URL, conf, WithIndex(file))
+	assert.Equal(t, map[string]PageChange{"": PageNew, "/a": PageNew, "/b": PageNew, "/c": PageNew},
+		changes(site.URL, first))
+	assert.Equal(t, 0, site.notModified)
+
+	// Nothing changed : every page is requested conditionally, and links are reused
+	second := runCrawl(site.URL, conf, WithIndex(file))
+	assert.Equal(t, map[string]PageChange{"": PageUnchanged, "/a": PageUnchanged, "/b": PageUnchanged,
+		"/c": PageUnchanged}, changes(site.URL, second))
+	assert.Equal(t, 4, site.notModified)
+	for _, res := range second {
+		if res.URL == site.URL+"/a" {
+			assert.Equal(t, http.StatusNotModified, res.Status)
+			assert.Equal(t, []string{site.URL + "/c"}, *res.Links)
+		}
+	}
+
+	// A page changes, a page is added, another is removed
+	site.update(func() {
+		site.versions["/b"]++
+		site.pages["/b"] = []string{"/d"}
+		site.pages["/d"] = []string{}
+		site.versions["/a"]++
+		site.pages["/a"] = []string{}
+		delete(site.pages, "/c")
+	})
+	third := runCrawl(site.URL, conf, WithIndex(file))
+	assert.Equal(t, map[string]PageChange{"": PageUnchanged, "/a": PageChanged, "/b": PageChanged,
+		"/c": PageRemoved, "/d": PageNew}, changes(site.URL, third))
+
+	index, err := loadIndex(file, site.URL)
+	assert.NoError(t, err)
+	assert.Len(t, index.Pages, 4)
+	assert.Nil(t, index.page(site.URL+"/c"))
+}
+
+// TestCrawlIndexUnknownNotModified verifies a page not modified but unknown to the previous crawl is retried, and not
+// recorded without its links
+func TestCrawlIndexUnknownNotModified(t *testing.T) {
+	var mutex sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		mutex.Unlock()
+
+		// A page is not modified the first time, another one always
+		if (r.URL.Path == "/a" && n == 1) || r.URL.Path == "/b" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		links := map[string]string{"/": `<a href="/a">a</a>`, "/a": `<a href="/b">b</a>`}[r.URL.Path]
+		_, _ = fmt.Fprintf(w, "<html><body>%s</body></html>", links)
+	}))
+	defer server.Close()
+	file, remove := tempStateFile(t)
+	defer remove()
+	conf := getTestConfig()
+
+	results := runCrawl(server.URL, conf, WithIndex(file))
+	assert.Equal(t, map[string]PageChange{"": PageNew, "/a": PageNew, "/b": ""}, changes(server.URL, results))
+	for _, res := range results {
+		switch res.URL {
+		case server.URL + "/a":
+			assert.NoError(t, res.Error)
+			assert.Equal(t, []string{server.URL + "/b"}, *res.Links)
+		case server.URL + "/b":
+			assert.Equal(t, errUnknownNotModified, res.Error)
+		}
+	}
+	assert.Equal(t, 2, requests["/a"])
+	assert.Equal(t, int(conf.Requests.Retries), requests["/b"])
+
+	index, err := loadIndex(file, server.URL)
+	assert.NoError(t, err)
+	assert.NotNil(t, index.page(server.URL+"/a"))
+	assert.Nil(t, index.page(server.URL+"/b"))
+}
+
+func TestLoadIndex(t *testing.T) {
+	file, remove := tempStateFile(t)
+	defer remove()
+
+	index, err := loadIndex(file, "https://example.com")
+	assert.NoError(t, err)
+	assert.Empty(t, index.Pages)
+
+	c := &crawler{
+		parameters: parameters{indexFile: file, previous: index},
+		task:       task{index: newCrawlIndex("https://example.com"), linkStates: linkStates{store: newMemoryStore()}},
+	}
+	c.index.Pages["https://example.com"] = &pageRecord{Status: 200, Links: []string{}}
+	assert.NoError(t, c.closeIndex(true))
+
+	if _, err := loadIndex(file, "https://example.org"); err == nil {
+		t.Error("loadIndex() should fail on an index of another domain")
+	}
+	index, err = loadIndex(file, "https://example.com")
+	assert.NoError(t, err)
+	assert.Len(t, index.Pages, 1)
+}
+
+func TestPageRecordSameAs(t *testing.T) {
+	a := &pageRecord{Status: 200, Links: []string{"a", "b"}}
+	assert.True(t, a.sameAs(&pageRecord{Status: 200, Links: []string{"a", "b"}}))
+	assert.False(t, a.sameAs(&pageRecord{Status: 200, Links: []string{"a", "c"}}))
+	assert.False(t, a.sameAs(&pageRecord{Status: 200, FinalURL: "x", Links: []string{"a", "b"}}))
+
+	// Validators are trusted over the content
+	a.ETag = `"1"`
+	assert.True(t, a.sameAs(&pageRecord{ETag: `"1"`}))
+	assert.False(t, a.sameAs(&pageRecord{ETag: `"2"`, Status: 200, Links: []string{"a", "b"}}))
+}
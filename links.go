@@ -3,6 +3,8 @@ package crawl
 import (
 	"io"
 	"net/url"
+	"strings"
+	"unicode"
 
 	"github.com/pkg/errors"
 	"golang.org/x/net/html"
@@ -11,33 +13,99 @@ import (
 )
 
 // extractLinks returns a slice of all links from an http.Get response body like reader object.
-// Links won't contain queries or fragments
+// Links won't contain queries or fragments, and links marked rel="nofollow" are left out
 // It does not close the reader.
 func extractLinks(origin string, body io.Reader) []string {
+	return extractPage(origin, body, false).links
+}
+
+// pageContent is what is extracted from a web page
+type pageContent struct {
+	links    []string
+	nofollow []string // links only found with a rel="nofollow" attribute
+	title    string
+	words    map[string]int // number of occurrences of each word of the text, in lower case
+	info     *PageInfo
+}
+
+// extractPage returns the links, as extractLinks, the title, the words of the text and the metadata of a web page.
+// Links keep their query if keepQuery is set. It does not close the reader.
+func extractPage(origin string, body io.Reader, keepQuery bool) *pageContent {
 	tokens := html.NewTokenizer(body)
 
-	// This map is an intermediary container for found links, avoiding duplicates
-	links := make(map[string]bool)
+	// These maps are intermediary containers for found links, avoiding duplicates
+	found, nofollow := make(map[string]bool), make(map[string]bool)
+	page := &pageContent{links: nil, nofollow: nil, title: "", words: make(map[string]int), info: newPageInfo()}
+	inTitle, inScript, inHeading := false, false, false
+	heading := ""
 
 	for typ := tokens.Next(); typ != html.ErrorToken; typ = tokens.Next() {
 		token := tokens.Token()
-		if typ == html.StartTagToken && token.Data == "a" {
+		switch {
+		case typ == html.StartTagToken && token.Data == "a":
 			// If it's an anchor, try get the link
-			if link := extractLink(origin, token); link != "" {
-				links[link] = true
-				continue
+			if link := extractLink(origin, token, keepQuery); link != "" {
+				if hasRel(token, "nofollow") {
+					nofollow[link] = true
+				} else {
+					found[link] = true
+				}
 			}
+		case typ == html.StartTagToken && token.Data == "title":
+			inTitle = page.title == ""
+		case typ == html.EndTagToken && token.Data == "title":
+			inTitle = false
+		case typ == html.StartTagToken && (token.Data == "script" || token.Data == "style"):
+			inScript = true
+		case typ == html.EndTagToken && (token.Data == "script" || token.Data == "style"):
+			inScript = false
+		case (typ == html.StartTagToken || typ == html.SelfClosingTagToken) && token.Data == "meta":
+			page.info.readMeta(token)
+		case (typ == html.StartTagToken || typ == html.SelfClosingTagToken) && token.Data == "link":
+			page.info.readLink(origin, token)
+		case typ == html.StartTagToken && token.Data == "h1":
+			inHeading, heading = true, ""
+		case typ == html.EndTagToken && token.Data == "h1" && inHeading:
+			inHeading = false
+			page.info.Headings = append(page.info.Headings, strings.Join(strings.Fields(heading), " "))
+		case typ == html.TextToken && inTitle:
+			page.title += token.Data
+		case typ == html.TextToken && !inScript:
+			if inHeading {
+				heading += token.Data
+			}
+			countWords(page.words, token.Data)
 		}
 	}
-	return mapToSlice(links)
+
+	for link := range found {
+		delete(nofollow, link)
+	}
+	page.links = mapToSlice(found)
+	page.nofollow = mapToSlice(nofollow)
+	page.title = strings.TrimSpace(page.title)
+	page.info.Title = page.title
+	for _, n := range page.words {
+		page.info.WordCount += n
+	}
+	return page
+}
+
+// countWords adds the words of text, in lower case, to words
+func countWords(words map[string]int, text string) {
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		words[word]++
+	}
 }
 
 // extractLink tries to return the link inside the token
-func extractLink(origin string, token html.Token) string {
+func extractLink(origin string, token html.Token, keepQuery bool) string {
 	// get href value
 	for _, a := range token.Attr {
 		if a.Key == "href" {
-			link, err := sanitise(origin, a.Val)
+			link, err := sanitiseLink(origin, a.Val, keepQuery)
 			if err != nil {
 				log.WithFields(logrus.Fields{
 					"url":   origin,
@@ -55,7 +123,13 @@ func extractLink(origin string, token html.Token) string {
 // - rebuilds the absolute url if the given link is relative to origin
 // - escapes invalid links
 // - strips queries and fragments
+// - converts internationalised host names to ASCII, and escapes paths the same way
 func sanitise(origin string, link string) (string, error) {
+	return sanitiseLink(origin, link, false)
+}
+
+// sanitiseLink is sanitise, keeping the query of the link if keepQuery is set
+func sanitiseLink(origin string, link string, keepQuery bool) (string, error) {
 	u, err := url.Parse(link)
 	if err != nil {
 		return "", errors.Wrap(err, "Error in parsing url")
@@ -71,7 +145,12 @@ func sanitise(origin string, link string) (string, error) {
 	}
 	u = base.ResolveReference(u)
 
-	stripQuery(u)
+	if keepQuery {
+		u.Fragment = ""
+	} else {
+		stripQuery(u)
+	}
+	normaliseURL(u)
 
 	log.WithField("url", origin).Tracef("Rewrote '%s' to '%s'", link, u.String())
 
@@ -1,6 +1,7 @@
 package crawl
 
 import (
+	"strings"
 	"testing"
 
 	"golang.org/x/net/html"
@@ -56,14 +57,14 @@ func TestExtractLink(t *testing.T) {
 
 	// Should return ""
 	// nil slice on token.Attr
-	if extractLink("", testToken) != "" {
+	if extractLink("", testToken, false) != "" {
 		t.Errorf(errMsgF, "token.Attr is nil")
 	}
 
 	// Should return ""
 	// valid token.Attr but no href
 	testToken.Attr = []html.Attribute{testAttribute}
-	if extractLink("", testToken) != "" {
+	if extractLink("", testToken, false) != "" {
 		t.Errorf(errMsgF, "no href was found")
 	}
 
@@ -73,7 +74,24 @@ func TestExtractLink(t *testing.T) {
 	testAttribute.Val = "%"
 	testToken.Attr = []html.Attribute{testAttribute}
 
-	if extractLink("", testToken) != "" {
+	if extractLink("", testToken, false) != "" {
 		t.Errorf(errMsgF, "token.Attr.Val is not valid for sanitise()")
 	}
 }
+
+// TestExtractPage verifies the title of a page is found along with its links
+func TestExtractPage(t *testing.T) {
+	page := `<html><head><title> Home &amp; more </title><script>var a = 1;</script></head>` +
+		`<body><a href="/a">A link</a>, a <b>link</b><svg><title>icon</title></svg></body></html>`
+
+	content := extractPage("https://example.com", strings.NewReader(page), false)
+	if content.title != "Home & more" {
+		t.Errorf("extractPage() should return the page's title, got '%s'", content.title)
+	}
+	if len(content.links) != 1 || content.links[0] != "https://example.com/a" {
+		t.Errorf("extractPage() should return the page's links, got %v", content.links)
+	}
+	if len(content.words) != 3 || content.words["a"] != 2 || content.words["link"] != 2 {
+		t.Errorf("extractPage() should return the words of the page's text, got %v", content.words)
+	}
+}
@@ -0,0 +1,254 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorKind classifies the errors of failed attempts at retrieving pages
+type ErrorKind string
+
+const (
+	// ErrorTimeout is for requests that timed out
+	ErrorTimeout ErrorKind = "timeout"
+
+	// ErrorNetwork is for requests that could not be sent, or whose response could not be read
+	ErrorNetwork ErrorKind = "network"
+
+	// ErrorRedirect is for redirections that loop or go on for too long
+	ErrorRedirect ErrorKind = "redirect"
+
+	// ErrorBody is for bodies too large once decoded
+	ErrorBody ErrorKind = "body"
+
+	// ErrorOther is for any other error
+	ErrorOther ErrorKind = "other"
+)
+
+// errorKind returns the kind of err
+func errorKind(err error) ErrorKind {
+	switch cause := errors.Cause(err); {
+	case isRedirectError(err):
+		return ErrorRedirect
+	case isBodyError(err):
+		return ErrorBody
+	case cause == context.DeadlineExceeded:
+		return ErrorTimeout
+	default:
+		if nerr, ok := cause.(net.Error); ok {
+			if nerr.Timeout() {
+				return ErrorTimeout
+			}
+			return ErrorNetwork
+		}
+		if _, ok := cause.(*url.Error); ok || cause == io.ErrUnexpectedEOF {
+			return ErrorNetwork
+		}
+		return ErrorOther
+	}
+}
+
+// Metrics receives measures of a crawl as it goes, e.g. to export them to a monitoring system. Its methods may be
+// called concurrently.
+type Metrics interface {
+	// PageFetched is called for every page retrieved, whatever its status code
+	PageFetched(status int)
+
+	// Error is called for every failed attempt at retrieving a page
+	Error(kind ErrorKind)
+
+	// Retry is called when a page is attempted again after an error
+	Retry()
+
+	// BytesDownloaded is called with the number of bytes of every body received, before decoding
+	BytesDownloaded(n int64)
+
+	// QueueLength is called with the number of links waiting to be visited when it changes
+	QueueLength(n int)
+
+	// InFlight is called with the number of pages being retrieved when it changes
+	InFlight(n int)
+
+	// RequestLatency is called with the time it took to get the response headers of every request
+	RequestLatency(d time.Duration)
+}
+
+// noMetrics is used when no Metrics are given
+type noMetrics struct{}
+
+func (noMetrics) PageFetched(int)              {}
+func (noMetrics) Error(ErrorKind)              {}
+func (noMetrics) Retry()                       {}
+func (noMetrics) BytesDownloaded(int64)        {}
+func (noMetrics) QueueLength(int)              {}
+func (noMetrics) InFlight(int)                 {}
+func (noMetrics) RequestLatency(time.Duration) {}
+
+// latencyBuckets are the upper bounds of the request latency histogram, in seconds, those of Prometheus by default
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics holds the measures of a crawl, and serves them over HTTP in the Prometheus text format
+type PrometheusMetrics struct {
+	mutex      sync.Mutex
+	pages      map[int]uint64
+	errors     map[ErrorKind]uint64
+	retries    uint64
+	bytes      uint64
+	queue      int
+	inFlight   int
+	latencies  []uint64 // per bucket, not cumulated
+	latencySum float64
+	latencyN   uint64
+}
+
+// NewPrometheusMetrics returns Metrics that can be given to WithMetrics, and served as an http.Handler, e.g. on
+// /metrics for Prometheus to scrape
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		mutex:      sync.Mutex{},
+		pages:      make(map[int]uint64),
+		errors:     make(map[ErrorKind]uint64),
+		retries:    0,
+		bytes:      0,
+		queue:      0,
+		inFlight:   0,
+		latencies:  make([]uint64, len(latencyBuckets)+1),
+		latencySum: 0,
+		latencyN:   0,
+	}
+}
+
+func (m *PrometheusMetrics) PageFetched(status int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pages[status]++
+}
+
+func (m *PrometheusMetrics) Error(kind ErrorKind) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.errors[kind]++
+}
+
+func (m *PrometheusMetrics) Retry() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.retries++
+}
+
+func (m *PrometheusMetrics) BytesDownloaded(n int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.bytes += uint64(n)
+}
+
+func (m *PrometheusMetrics) QueueLength(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.queue = n
+}
+
+func (m *PrometheusMetrics) InFlight(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.inFlight = n
+}
+
+func (m *PrometheusMetrics) RequestLatency(d time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	m.latencies[i]++
+	m.latencySum += seconds
+	m.latencyN++
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.write(w)
+}
+
+// write writes the metrics to w, in the Prometheus text exposition format
+func (m *PrometheusMetrics) write(w io.Writer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	p := &promWriter{w: w, err: nil}
+
+	p.header("crawl_pages_fetched_total", "counter", "Pages retrieved, by status code.")
+	codes := make([]int, 0, len(m.pages))
+	for code := range m.pages {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		p.sample(fmt.Sprintf(`crawl_pages_fetched_total{code="%d"}`, code), float64(m.pages[code]))
+	}
+
+	p.header("crawl_errors_total", "counter", "Failed attempts at retrieving pages, by kind of error.")
+	kinds := make([]string, 0, len(m.errors))
+	for kind := range m.errors {
+		kinds = append(kinds, string(kind))
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		p.sample(fmt.Sprintf(`crawl_errors_total{kind="%s"}`, kind), float64(m.errors[ErrorKind(kind)]))
+	}
+
+	p.header("crawl_retries_total", "counter", "Pages attempted again after an error.")
+	p.sample("crawl_retries_total", float64(m.retries))
+
+	p.header("crawl_downloaded_bytes_total", "counter", "Bytes of bodies received, before decoding.")
+	p.sample("crawl_downloaded_bytes_total", float64(m.bytes))
+
+	p.header("crawl_queue_length", "gauge", "Links waiting to be visited.")
+	p.sample("crawl_queue_length", float64(m.queue))
+
+	p.header("crawl_workers_in_flight", "gauge", "Pages being retrieved.")
+	p.sample("crawl_workers_in_flight", float64(m.inFlight))
+
+	p.header("crawl_request_duration_seconds", "histogram", "Time to get the response headers of requests.")
+	var cumulated uint64
+	for i, bound := range latencyBuckets {
+		cumulated += m.latencies[i]
+		le := strconv.FormatFloat(bound, 'g', -1, 64)
+		p.sample(fmt.Sprintf(`crawl_request_duration_seconds_bucket{le="%s"}`, le), float64(cumulated))
+	}
+	p.sample(`crawl_request_duration_seconds_bucket{le="+Inf"}`, float64(m.latencyN))
+	p.sample("crawl_request_duration_seconds_sum", m.latencySum)
+	p.sample("crawl_request_duration_seconds_count", float64(m.latencyN))
+
+	return p.err
+}
+
+// promWriter writes lines of the Prometheus text format, keeping the first error
+type promWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *promWriter) header(name, kind, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (p *promWriter) sample(name string, value float64) {
+	p.printf("%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (p *promWriter) printf(format string, a ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, a...)
+	}
+}
@@ -0,0 +1,114 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// TestErrorKind verifies errors are classified by their cause
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind ErrorKind
+	}{
+		{errors.Wrap(&url.Error{Op: "Get", URL: "/", Err: errRedirectLoop}, "Error in downloading resource"), ErrorRedirect},
+		{errors.Wrap(errBodyTooSparse, "Error in downloading resource"), ErrorBody},
+		{errors.Wrap(&url.Error{Op: "Get", URL: "/", Err: timeoutError{}}, "Error in downloading resource"), ErrorTimeout},
+		{context.DeadlineExceeded, ErrorTimeout},
+		{&url.Error{Op: "Get", URL: "/", Err: io.EOF}, ErrorNetwork},
+		{errors.Wrap(io.ErrUnexpectedEOF, "Error in downloading resource"), ErrorNetwork},
+		{errors.New("something else"), ErrorOther},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.kind, errorKind(test.err), test.err.Error())
+	}
+}
+
+// TestPrometheusMetrics verifies the metrics are served in the Prometheus text format
+func TestPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics()
+	m.PageFetched(200)
+	m.PageFetched(200)
+	m.PageFetched(404)
+	m.Error(ErrorTimeout)
+	m.Retry()
+	m.BytesDownloaded(1500)
+	m.QueueLength(7)
+	m.InFlight(2)
+	m.RequestLatency(30 * time.Millisecond)
+	m.RequestLatency(2 * time.Second)
+	m.RequestLatency(time.Minute)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE crawl_pages_fetched_total counter\n",
+		`crawl_pages_fetched_total{code="200"} 2` + "\n",
+		`crawl_pages_fetched_total{code="404"} 1` + "\n",
+		`crawl_errors_total{kind="timeout"} 1` + "\n",
+		"crawl_retries_total 1\n",
+		"crawl_downloaded_bytes_total 1500\n",
+		"# TYPE crawl_queue_length gauge\ncrawl_queue_length 7\n",
+		"crawl_workers_in_flight 2\n",
+		"# TYPE crawl_request_duration_seconds histogram\n",
+		`crawl_request_duration_seconds_bucket{le="0.025"} 0` + "\n",
+		`crawl_request_duration_seconds_bucket{le="0.05"} 1` + "\n",
+		`crawl_request_duration_seconds_bucket{le="2.5"} 2` + "\n",
+		`crawl_request_duration_seconds_bucket{le="10"} 2` + "\n",
+		`crawl_request_duration_seconds_bucket{le="+Inf"} 3` + "\n",
+		"crawl_request_duration_seconds_sum 62.03\n",
+		"crawl_request_duration_seconds_count 3\n",
+	} {
+		assert.Contains(t, body, line)
+	}
+}
+
+// TestCrawlMetrics verifies the crawler measures pages, errors and retries
+func TestCrawlMetrics(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			_, _ = fmt.Fprint(w, `<a href="/missing">missing</a><a href="/broken">broken</a>`)
+		case "/broken":
+			// Close the connection without a response
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	m := NewPrometheusMetrics()
+	conf := getTestConfig()
+	runCrawl(site.URL, conf, WithMetrics(m))
+
+	assert.Equal(t, map[int]uint64{200: 1, 404: 1}, m.pages)
+	assert.Equal(t, map[ErrorKind]uint64{ErrorNetwork: uint64(conf.Requests.Retries)}, m.errors)
+	assert.Equal(t, uint64(conf.Requests.Retries-1), m.retries)
+	assert.Equal(t, uint64(2+conf.Requests.Retries), m.latencyN)
+	assert.True(t, m.bytes > 0)
+	assert.Equal(t, 0, m.inFlight)
+	assert.Equal(t, 0, m.queue)
+}
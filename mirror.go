@@ -0,0 +1,211 @@
+package crawl
+
+import (
+	"bytes"
+	"crypto/sha1" // nolint:gosec // only used to shorten names, not a security measure
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+const (
+	mirrorIndex      = "index.html"
+	mirrorMaxSegment = 200 // bytes, most file systems don't allow more than 255
+	mirrorDirPerms   = 0755
+	mirrorFilePerms  = 0644
+)
+
+// mirror saves the pages of a crawl to a directory, as an offline copy of the site
+type mirror struct {
+	dir     string
+	rewrite bool // rewrite links in HTML pages to the local copies, once all pages are saved
+	mutex   sync.Mutex
+	saved   map[string]bool // relative paths of the saved pages
+	html    []string        // URLs of the saved HTML pages, whose links are rewritten
+}
+
+// newMirror returns a mirror saving pages to dir, which is created if need be
+func newMirror(dir string, rewrite bool) (*mirror, error) {
+	if err := os.MkdirAll(dir, mirrorDirPerms); err != nil {
+		return nil, errors.Wrapf(err, "Could not create mirror directory '%s'", dir)
+	}
+	return &mirror{dir: dir, rewrite: rewrite, mutex: sync.Mutex{}, saved: make(map[string]bool), html: nil}, nil
+}
+
+// shortHash returns a short hexadecimal hash of s
+func shortHash(s string) string {
+	sum := sha1.Sum([]byte(s)) // nolint:gosec // see import
+	return hex.EncodeToString(sum[:4])
+}
+
+// safeSegment returns the path segment without the characters file systems don't allow, and short enough
+func safeSegment(segment string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, segment)
+
+	if len(safe) > mirrorMaxSegment {
+		ext := path.Ext(safe)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		safe = safe[:mirrorMaxSegment-len(ext)-9] + "-" + shortHash(segment) + ext
+	}
+	return safe
+}
+
+// mirrorPath returns the relative path, with slashes, of the local copy of the page at u. Directories and pages without
+// an extension are saved as index files in a directory of their name, and pages with a query get a hash of the query
+// in their name.
+func mirrorPath(u *url.URL) string {
+	segments := []string{safeSegment(u.Host)}
+
+	p := path.Clean("/" + u.Path)
+	for _, segment := range strings.Split(p, "/") {
+		if segment != "" {
+			segments = append(segments, safeSegment(segment))
+		}
+	}
+
+	last := segments[len(segments)-1]
+	if len(segments) == 1 || strings.HasSuffix(u.Path, "/") || path.Ext(last) == "" {
+		segments = append(segments, mirrorIndex)
+		last = mirrorIndex
+	}
+
+	if u.RawQuery != "" {
+		ext := path.Ext(last)
+		segments[len(segments)-1] = strings.TrimSuffix(last, ext) + "-q" + shortHash(u.RawQuery) + ext
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// relativeLink returns the link from the local copy of page to the local copy of target
+func relativeLink(page, target *url.URL) string {
+	from := path.Dir(mirrorPath(page))
+	to := mirrorPath(target)
+
+	rel, err := filepath.Rel(filepath.FromSlash(from), filepath.FromSlash(to))
+	if err != nil {
+		return ""
+	}
+	rel = filepath.ToSlash(rel)
+	if target.Fragment != "" {
+		rel += "#" + target.Fragment
+	}
+	return rel
+}
+
+// rewriteLinks returns the HTML page with its links to pages of the same host pointing to their local copies, if they
+// were saved, as told by saved with their relative path, or to their absolute URL otherwise. The rest of the page is
+// kept as is.
+func rewriteLinks(page *url.URL, body []byte, saved func(path string) bool) []byte {
+	var out bytes.Buffer
+	tokens := html.NewTokenizer(bytes.NewReader(body))
+
+	for typ := tokens.Next(); typ != html.ErrorToken; typ = tokens.Next() {
+		raw := tokens.Raw()
+		if typ != html.StartTagToken && typ != html.SelfClosingTagToken {
+			_, _ = out.Write(raw)
+			continue
+		}
+
+		token := tokens.Token()
+		if token.Data != "a" || !rewriteHref(page, &token, saved) {
+			_, _ = out.Write(raw)
+			continue
+		}
+		_, _ = out.WriteString(token.String())
+	}
+
+	return out.Bytes()
+}
+
+// rewriteHref points the href of an anchor token to the local copy of its target, if it's a saved page of the same
+// host, or to its absolute URL if it's another page of the host, and returns whether it did
+func rewriteHref(page *url.URL, token *html.Token, saved func(path string) bool) bool {
+	for i, a := range token.Attr {
+		if a.Key != "href" {
+			continue
+		}
+		link, err := url.Parse(strings.TrimSpace(a.Val))
+		if err != nil {
+			return false
+		}
+		target := page.ResolveReference(link)
+		if target.Host != page.Host || (target.Scheme != "http" && target.Scheme != "https") {
+			return false
+		}
+		if saved(mirrorPath(target)) {
+			token.Attr[i].Val = relativeLink(page, target)
+		} else {
+			token.Attr[i].Val = target.String()
+		}
+		return true
+	}
+	return false
+}
+
+// save writes the body of the page at pageURL to its local copy. HTML pages are kept to have their links rewritten
+// once the crawl is over, if asked for.
+func (m *mirror) save(pageURL, contentType string, body []byte) error {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return errors.Wrap(err, "Could not parse url")
+	}
+
+	local := mirrorPath(u)
+	file := filepath.Join(m.dir, filepath.FromSlash(local))
+	if err = os.MkdirAll(filepath.Dir(file), mirrorDirPerms); err != nil {
+		return errors.Wrap(err, "Could not create mirror directory")
+	}
+	if err = ioutil.WriteFile(file, body, mirrorFilePerms); err != nil {
+		return errors.Wrap(err, "Could not write mirror file")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.saved[local] = true
+	if m.rewrite && strings.Contains(contentType, "html") {
+		m.html = append(m.html, pageURL)
+	}
+	return nil
+}
+
+// has returns whether the page at the relative path was saved
+func (m *mirror) has(path string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.saved[path]
+}
+
+// close rewrites the links of the saved HTML pages, now that it's known which pages were saved, and returns the first
+// error
+func (m *mirror) close() error {
+	var first error
+	for _, page := range m.html {
+		u, _ := url.Parse(page)
+		file := filepath.Join(m.dir, filepath.FromSlash(mirrorPath(u)))
+		body, err := ioutil.ReadFile(file)
+		if err == nil {
+			err = ioutil.WriteFile(file, rewriteLinks(u, body, m.has), mirrorFilePerms)
+		}
+		if err != nil && first == nil {
+			first = errors.Wrapf(err, "Could not rewrite the links of '%s'", file)
+		}
+	}
+	m.html = nil
+	return first
+}
@@ -0,0 +1,112 @@
+package crawl
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorPath(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com":                  "example.com/index.html",
+		"https://example.com/":                 "example.com/index.html",
+		"https://example.com/a/":               "example.com/a/index.html",
+		"https://example.com/a":                "example.com/a/index.html",
+		"https://example.com/a/b.css":          "example.com/a/b.css",
+		"https://example.com/a/../../b.html":   "example.com/b.html",
+		"https://example.com:8080/a%3Cb%3E.js": "example.com_8080/a_b_.js",
+		"https://example.com/a?x=1":            "example.com/a/index-q" + shortHash("x=1") + ".html",
+		"https://example.com/a.php?x=1":        "example.com/a-q" + shortHash("x=1") + ".php",
+	}
+
+	for link, expected := range tests {
+		u, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expected, mirrorPath(u), link)
+	}
+
+	// Long names are shortened, keeping their extension
+	u, _ := url.Parse("https://example.com/" + strings.Repeat("a", 300) + ".html")
+	name := filepath.Base(mirrorPath(u))
+	assert.True(t, len(name) <= mirrorMaxSegment)
+	assert.Equal(t, ".html", filepath.Ext(name))
+}
+
+func TestRewriteLinks(t *testing.T) {
+	page, _ := url.Parse("https://example.com/docs/intro")
+	body := `<html><script>if (a < b) {}</script><a class="x" href="/docs/next#part">next</a>` +
+		`<a href="../about/">about</a><a href="https://other.com/">other</a><img src="/logo.png">` +
+		`<a href="missing">missing</a></html>`
+	saved := func(path string) bool {
+		return path != "example.com/docs/missing/index.html"
+	}
+
+	rewritten := string(rewriteLinks(page, []byte(body), saved))
+
+	assert.Contains(t, rewritten, `<script>if (a < b) {}</script>`)
+	assert.Contains(t, rewritten, `<a class="x" href="../next/index.html#part">`)
+	assert.Contains(t, rewritten, `<a href="../../about/index.html">`)
+	assert.Contains(t, rewritten, `<a href="https://example.com/docs/missing">`)
+	assert.Contains(t, rewritten, `<a href="https://other.com/">`)
+	assert.Contains(t, rewritten, `<img src="/logo.png">`)
+}
+
+// TestCrawlMirror verifies crawled pages are saved with their links rewritten to those that were saved
+func TestCrawlMirror(t *testing.T) {
+	site := newSiteServer(map[string][]string{
+		"/":         {"/a", "/b/c.html", "/missing"},
+		"/a":        {"/b/c.html"},
+		"/b/c.html": {},
+	})
+	defer site.Close()
+	file, remove := tempStateFile(t)
+	defer remove()
+	dir := filepath.Join(filepath.Dir(file), "mirror")
+
+	runCrawl(site.URL, getTestConfig(), WithMirror(dir, true))
+
+	host := strings.Replace(strings.TrimPrefix(site.URL, "http://"), ":", "_", 1)
+	for page, contains := range map[string]string{
+		"index.html":   `<a href="a/index.html">`,
+		"a/index.html": `<a href="../b/c.html">`,
+		"b/c.html":     "<html><body></body></html>",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, host, filepath.FromSlash(page)))
+		if err != nil {
+			t.Fatalf("page %s should be mirrored : %s", page, err)
+		}
+		assert.Contains(t, string(data), contains)
+	}
+
+	// The page that could not be saved is still linked to online
+	data, _ := ioutil.ReadFile(filepath.Join(dir, host, "index.html"))
+	assert.Contains(t, string(data), `<a href="`+site.URL+`/missing">`)
+}
+
+// TestCrawlMirrorQueries verifies pages only differing by their query are saved to different files
+func TestCrawlMirrorQueries(t *testing.T) {
+	site := newSiteServer(map[string][]string{
+		"/":  {"/p?id=1", "/p?id=2#top"},
+		"/p": {},
+	})
+	defer site.Close()
+	file, remove := tempStateFile(t)
+	defer remove()
+	dir := filepath.Join(filepath.Dir(file), "mirror")
+
+	runCrawl(site.URL, getTestConfig(), WithMirror(dir, false))
+
+	assert.Equal(t, 2, site.hit("/p"))
+	host := strings.Replace(strings.TrimPrefix(site.URL, "http://"), ":", "_", 1)
+	for _, query := range []string{"id=1", "id=2"} {
+		_, err := os.Stat(filepath.Join(dir, host, "p", "index-q"+shortHash(query)+".html"))
+		assert.NoError(t, err, query)
+	}
+}
@@ -0,0 +1,246 @@
+package crawl
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Option sets a running parameter of the crawler or scraper. Options take precedence over the configuration file
+// and environment variables.
+type Option func(*parameters)
+
+// WithHTTPClient makes all requests go through client, e.g. to share a transport and its connection pool with the
+// rest of an application. Its redirection policy is replaced by the crawler's.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *parameters) {
+		p.client = newClient(client)
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(p *parameters) {
+		p.headers.set("User-Agent", userAgent)
+	}
+}
+
+// WithHeader sets a header sent with every request, replacing the configured value if any.
+func WithHeader(name, value string) Option {
+	return func(p *parameters) {
+		p.headers.set(name, value)
+	}
+}
+
+// WithHostHeader sets a header only sent with requests to host, given without port. It overrides the headers
+// sent with every request.
+func WithHostHeader(host, name, value string) Option {
+	return func(p *parameters) {
+		p.headers.setHost(host, name, value)
+	}
+}
+
+// WithCookieJar stores and sends cookies with jar, e.g. one holding a session opened elsewhere. The jar is kept
+// whatever the order of options, also on a client given with WithHTTPClient.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(p *parameters) {
+		p.jar = jar
+	}
+}
+
+// WithBasicAuth authenticates every request with HTTP Basic authentication.
+func WithBasicAuth(username, password string) Option {
+	return func(p *parameters) {
+		p.headers.set("Authorization", basicAuth(username, password))
+	}
+}
+
+// WithBearerToken authenticates every request with a bearer token.
+func WithBearerToken(token string) Option {
+	return func(p *parameters) {
+		p.headers.set("Authorization", "Bearer "+token)
+	}
+}
+
+// WithProxy routes requests through proxy, an http, https or socks5 url. Proxy authentication is given as the url's
+// user information. It has no effect on a client given with WithHTTPClient.
+func WithProxy(proxy *url.URL) Option {
+	return func(p *parameters) {
+		p.proxies.fallback = http.ProxyURL(proxy)
+	}
+}
+
+// WithHostProxy routes requests to host through proxy, or directly if proxy is nil, overriding WithProxy. A host given
+// with a leading dot, e.g. ".example.com", also matches its subdomains.
+func WithHostProxy(host string, proxy *url.URL) Option {
+	return func(p *parameters) {
+		p.proxies.setHost(host, proxy)
+	}
+}
+
+// WithState saves the crawl state to file on shutdown and every interval, if not 0, so it can be resumed later.
+func WithState(file string, interval time.Duration) Option {
+	return func(p *parameters) {
+		p.stateFile = file
+		p.stateInterval = interval
+	}
+}
+
+// WithResume makes the crawler continue from the state saved in the state file, if it exists, instead of starting
+// from scratch.
+func WithResume() Option {
+	return func(p *parameters) {
+		p.resume = true
+	}
+}
+
+// WithStateStore keeps the state of links in store instead of the configured one. The crawler closes the store when
+// it is done.
+func WithStateStore(store StateStore) Option {
+	return func(p *parameters) {
+		p.store = store
+	}
+}
+
+// WithBloomFilter deduplicates links found during the crawl with a Bloom filter once more than threshold links were
+// seen, instead of keeping them all in memory. A fraction of new links, bounded by falsePositive, is wrongly taken for
+// already seen and not visited. It must be between 0 and 1 excluded, or the crawl fails to start.
+func WithBloomFilter(falsePositive float64, threshold int) Option {
+	return func(p *parameters) {
+		p.dedup = dedupBloom
+		p.falsePositive = falsePositive
+		p.dedupThreshold = threshold
+	}
+}
+
+// WithIndex recrawls the domain incrementally : pages found by the previous crawl in the index file are requested
+// conditionally, and reported with how they changed. Pages of the previous crawl that are not found anymore are
+// reported as removed at the end of the crawl. The index file is then replaced with the pages of this crawl.
+func WithIndex(file string) Option {
+	return func(p *parameters) {
+		p.indexFile = file
+	}
+}
+
+// WithWARC archives every request and response of the crawl, including redirections, in gzipped WARC files written
+// to dir. A new file is started when one is larger than maxSize bytes, or the configured size if 0. Credentials in
+// request headers are not archived.
+func WithWARC(dir string, maxSize int64) Option {
+	return func(p *parameters) {
+		p.warcDir = dir
+		if maxSize > 0 {
+			p.warcMaxSize = maxSize
+		}
+	}
+}
+
+// WithMirror saves the pages of the crawl to dir, as an offline copy of the site. Pages are saved under a directory
+// per host, at their URL path. Directories and pages without an extension are saved as index.html files in a
+// directory of their name. Links keep their query, so that pages only differing by it are crawled and saved to files
+// named with a hash of the query. If rewrite is set, once the crawl is over, links between pages of the host are
+// rewritten to point to the local copies of the pages that were saved, and to the absolute URLs of the others, e.g.
+// pages that failed, were not followed or are beyond the crawl's reach, so that they still work.
+func WithMirror(dir string, rewrite bool) Option {
+	return func(p *parameters) {
+		p.mirrorDir = dir
+		p.mirrorRewrite = rewrite
+	}
+}
+
+// WithDuplicates detects pages with the same content, and pages with near-identical texts, whose SimHash fingerprints
+// differ by at most distance bits, up to 3. Clusters of duplicates are available once the crawl is over. If skipLinks
+// is set, links are not extracted from pages with the same content as another.
+func WithDuplicates(distance int, skipLinks bool) Option {
+	return func(p *parameters) {
+		p.duplicates = true
+		p.nearDistance = distance
+		p.skipDuplicates = skipLinks
+	}
+}
+
+// WithDuplicateDetection detects duplicate and near-duplicate pages as WithDuplicates does, with the distance and the
+// skipping of links set by the configuration.
+func WithDuplicateDetection() Option {
+	return func(p *parameters) {
+		p.duplicates = true
+	}
+}
+
+// WithPageInfo extracts the metadata of successfully retrieved pages into their LinkMap's Info, along with their links.
+func WithPageInfo() Option {
+	return func(p *parameters) {
+		p.pageInfo = true
+	}
+}
+
+// WithIgnoreRobots follows links marked rel="nofollow", and the links of pages whose robots meta tag or X-Robots-Tag
+// header say nofollow, which are otherwise reported as skipped in their LinkMap.
+func WithIgnoreRobots() Option {
+	return func(p *parameters) {
+		p.ignoreRobots = true
+	}
+}
+
+// WithCanonical checks the canonical links of pages, whose problems are available once the crawl is over : canonical
+// pages that are broken, on another host, declaring another canonical page, or the page itself written differently.
+// If dedupe is set, the links of pages declaring another canonical page are not followed : only their canonical page
+// is crawled, so that variants of a page don't lead to crawling the same links again.
+func WithCanonical(dedupe bool) Option {
+	return func(p *parameters) {
+		p.canonical = true
+		p.dedupCanonical = dedupe
+	}
+}
+
+// WithFetcher retrieves pages with fetcher instead of the shared HTTP client, e.g. to get them from a cache or a
+// browser. The redirection policy and WARC archiving are those of the shared client, and don't apply to fetcher, nor
+// does the decoding of compressed bodies.
+func WithFetcher(fetcher Fetcher) Option {
+	return func(p *parameters) {
+		p.fetcher = fetcher
+	}
+}
+
+// WithRenderer replaces the body of successfully retrieved HTML pages by their DOM rendered by render, e.g. with a
+// headless browser, so that links added by scripts are found.
+func WithRenderer(render RenderFunc) Option {
+	return func(p *parameters) {
+		p.render = render
+	}
+}
+
+// WithExtractor extracts the links of documents of mediaType, like "application/json", with extractor. It replaces the
+// built-in extractor of that type, if any : HTML, CSS, XML sitemaps, RSS and Atom feeds, plain text and PDF.
+func WithExtractor(mediaType string, extractor Extractor) Option {
+	return func(p *parameters) {
+		p.extractors[strings.ToLower(mediaType)] = extractor
+	}
+}
+
+// WithoutCompression asks for uncompressed bodies, instead of gzip, deflate or brotli compressed ones.
+func WithoutCompression() Option {
+	return func(p *parameters) {
+		p.compression = false
+	}
+}
+
+// WithBodyLimits makes reading a body fail when it is larger than maxSize bytes once decoded, or as received when
+// archiving to WARC files, or when, past 1MB, it decodes to more than maxRatio times the bytes received, as
+// decompression bombs do. A limit of 0 is no limit.
+func WithBodyLimits(maxSize int64, maxRatio int) Option {
+	return func(p *parameters) {
+		p.maxBodySize = maxSize
+		p.maxBodyRatio = int64(maxRatio)
+	}
+}
+
+// WithMetrics gives metrics the measures of the crawl as it goes, e.g. those of NewPrometheusMetrics. nil disables them.
+func WithMetrics(metrics Metrics) Option {
+	return func(p *parameters) {
+		if metrics == nil {
+			metrics = noMetrics{}
+		}
+		p.metrics = metrics
+	}
+}
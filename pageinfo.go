@@ -0,0 +1,122 @@
+package crawl
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// PageInfo holds the metadata of a web page, as used for SEO audits
+type PageInfo struct {
+	Title       string
+	Description string            // content of the description meta tag
+	Canonical   string            // absolute URL of the canonical link, if any
+	Robots      string            // content of the robots meta tag, in lower case
+	Alternates  []Alternate       // alternate versions of the page in other languages
+	Headings    []string          // text of the h1 headings
+	OpenGraph   map[string]string // Open Graph properties, by name without the og: prefix
+	WordCount   int               // number of words of the text, outside of scripts and styles
+}
+
+// Alternate is a version of a page in another language, as declared by a hreflang link
+type Alternate struct {
+	Lang string
+	URL  string
+}
+
+// newPageInfo returns an empty PageInfo
+func newPageInfo() *PageInfo {
+	return &PageInfo{
+		Title:       "",
+		Description: "",
+		Canonical:   "",
+		Robots:      "",
+		Alternates:  nil,
+		Headings:    nil,
+		OpenGraph:   make(map[string]string),
+		WordCount:   0,
+	}
+}
+
+// attribute returns the value of the attribute key of token, and whether it is present
+func attribute(token html.Token, key string) (string, bool) {
+	for _, a := range token.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// hasRel returns whether the rel attribute of token holds value
+func hasRel(token html.Token, value string) bool {
+	rel, _ := attribute(token, "rel")
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if r == value {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns href as an absolute URL relative to origin, keeping its query, or an empty string if it is invalid
+func resolve(origin, href string) string {
+	base, err := url.Parse(origin)
+	if err != nil {
+		return ""
+	}
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return ""
+	}
+	ref = base.ResolveReference(ref)
+	ref.Fragment = ""
+	return ref.String()
+}
+
+// readMeta fills info with the content of a meta tag, if it is a known one. The first occurrence of a tag wins.
+func (info *PageInfo) readMeta(token html.Token) {
+	content, _ := attribute(token, "content")
+	content = strings.TrimSpace(content)
+
+	if property, ok := attribute(token, "property"); ok && strings.HasPrefix(property, "og:") {
+		if _, ok := info.OpenGraph[property[3:]]; !ok {
+			info.OpenGraph[property[3:]] = content
+		}
+		return
+	}
+
+	name, _ := attribute(token, "name")
+	switch strings.ToLower(name) {
+	case "description":
+		if info.Description == "" {
+			info.Description = content
+		}
+	case "robots":
+		if info.Robots == "" {
+			info.Robots = strings.ToLower(content)
+		}
+	}
+}
+
+// readLink fills info with the canonical or alternate link held by a link tag, relative to origin
+func (info *PageInfo) readLink(origin string, token html.Token) {
+	href, ok := attribute(token, "href")
+	if !ok {
+		return
+	}
+
+	switch {
+	case hasRel(token, "canonical"):
+		if info.Canonical == "" {
+			info.Canonical = resolve(origin, href)
+		}
+	case hasRel(token, "alternate"):
+		if lang, ok := attribute(token, "hreflang"); ok {
+			if link := resolve(origin, href); link != "" {
+				info.Alternates = append(info.Alternates, Alternate{Lang: lang, URL: link})
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package crawl
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const infoPage = `<html><head>
+<title>Products</title>
+<meta name="Description" content=" All our products ">
+<meta name="description" content="ignored">
+<meta name="robots" content="NoIndex, Follow"/>
+<meta property="og:title" content="Our products">
+<meta property="og:image" content="https://cdn.example.com/p.png" />
+<link rel="canonical" href="/products?page=1#top">
+<link rel="alternate" hreflang="fr" href="https://example.com/fr/products">
+<link rel="alternate" type="application/rss+xml" href="/feed">
+<link rel="stylesheet" href="/style.css">
+</head><body>
+<h1>Our <em>best</em>
+products</h1>
+<p>Three more words</p>
+<h1></h1>
+</body></html>`
+
+// TestExtractPageInfo verifies the metadata of a page is extracted along with its links
+func TestExtractPageInfo(t *testing.T) {
+	info := extractPage("https://example.com/products", strings.NewReader(infoPage), false).info
+
+	assert.Equal(t, &PageInfo{
+		Title:       "Products",
+		Description: "All our products",
+		Canonical:   "https://example.com/products?page=1",
+		Robots:      "noindex, follow",
+		Alternates:  []Alternate{{Lang: "fr", URL: "https://example.com/fr/products"}},
+		Headings:    []string{"Our best products", ""},
+		OpenGraph:   map[string]string{"title": "Our products", "image": "https://cdn.example.com/p.png"},
+		WordCount:   6,
+	}, info)
+}
+
+// TestCrawlPageInfo verifies page metadata is only attached to results when asked for
+func TestCrawlPageInfo(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, infoPage)
+	}))
+	defer site.Close()
+
+	results := runCrawl(site.URL, getTestConfig())
+	assert.Len(t, results, 1)
+	assert.Nil(t, results[0].Info)
+
+	results = runCrawl(site.URL, getTestConfig(), WithPageInfo())
+	assert.Len(t, results, 1)
+	if assert.NotNil(t, results[0].Info) {
+		assert.Equal(t, site.URL+"/products?page=1", results[0].Info.Canonical)
+		assert.Equal(t, []string{"Our best products", ""}, results[0].Info.Headings)
+	}
+}
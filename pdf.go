@@ -0,0 +1,229 @@
+package crawl
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+const (
+	// pdfMaxStreamSize is the maximum size a compressed stream of a PDF is inflated to, against decompression bombs
+	pdfMaxStreamSize = 16 << 20
+
+	// pdfMaxInflatedSize is the maximum size all the compressed streams of a PDF are inflated to, against documents
+	// made of many bombs
+	pdfMaxInflatedSize = 64 << 20
+)
+
+var (
+	// pdfStream matches the end of a stream dictionary and the stream keyword, the data starting right after
+	pdfStream = regexp.MustCompile(`>>\s*stream\r?\n`)
+
+	// pdfFilters matches the filters streams may be compressed or encoded with, other than Flate
+	pdfFilters = regexp.MustCompile(`/(DCT|JPX|CCITTFax|JBIG2|LZW|ASCII85|ASCIIHex|RunLength)Decode`)
+
+	// pdfURI matches the key of the URI of a link annotation, followed by the start of its string
+	pdfURI = regexp.MustCompile(`/URI\s*[(<]`)
+)
+
+// extractPDF returns the links of a PDF document : the URIs of its link annotations, and the absolute URLs written in
+// its text. Compressed streams, holding the text of pages and often the annotations, are inflated if they are only
+// compressed with Flate. Text written with fonts that don't map to ASCII can't be read.
+func extractPDF(_ string, body io.Reader) ([]string, error) {
+	data, err := ioutil.ReadAll(body)
+
+	var links []string
+	for _, chunk := range pdfChunks(data, pdfMaxInflatedSize) {
+		links = append(links, pdfAnnotationURIs(chunk)...)
+		for _, match := range textURL.FindAll(pdfText(chunk), -1) {
+			links = append(links, strings.TrimRight(string(match), ".,;:!?)"))
+		}
+	}
+	return links, err
+}
+
+// pdfChunks returns what is outside of the streams of a PDF document, followed by the content of its streams, inflated
+// if they are compressed with Flate. Streams with other filters, like images, are left out, and so are compressed streams
+// once budget bytes were inflated.
+func pdfChunks(data []byte, budget int64) [][]byte {
+	var outside []byte
+	streams := [][]byte{nil}
+	last := 0
+	for _, loc := range pdfStream.FindAllIndex(data, -1) {
+		// Binary data of a stream may look like the start of another
+		if loc[0] < last {
+			continue
+		}
+		end := bytes.Index(data[loc[1]:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		content := data[loc[1] : loc[1]+end]
+		outside = append(outside, data[last:loc[1]]...)
+		last = loc[1] + end
+
+		// The dictionary is between the object's header and the stream keyword
+		dict := data[:loc[0]]
+		if obj := bytes.LastIndex(dict, []byte(" obj")); obj >= 0 {
+			dict = dict[obj:]
+		}
+
+		switch {
+		case !bytes.Contains(dict, []byte("/Filter")):
+			streams = append(streams, content)
+		case bytes.Contains(dict, []byte("/FlateDecode")) && !pdfFilters.Match(dict) && budget > 0:
+			limit := int64(pdfMaxStreamSize)
+			if budget < limit {
+				limit = budget
+			}
+			if inflated, err := inflate(content, limit); err == nil {
+				streams = append(streams, inflated)
+				budget -= int64(len(inflated))
+			}
+		}
+	}
+	streams[0] = append(outside, data[last:]...)
+	return streams
+}
+
+// inflate returns the zlib decompressed data, up to limit bytes. Truncated data is inflated as far as possible.
+func inflate(data []byte, limit int64) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	inflated, err := ioutil.ReadAll(io.LimitReader(r, limit))
+	if len(inflated) > 0 {
+		return inflated, nil
+	}
+	return nil, err
+}
+
+// pdfAnnotationURIs returns the URIs of the link annotations found in data
+func pdfAnnotationURIs(data []byte) []string {
+	var uris []string
+	for _, loc := range pdfURI.FindAllIndex(data, -1) {
+		start := loc[1] - 1
+		var uri []byte
+		if data[start] == '(' {
+			uri, _ = pdfLiteral(data, start)
+		} else {
+			uri = pdfHex(data, start)
+		}
+		if s := strings.TrimSpace(string(uri)); s != "" {
+			uris = append(uris, s)
+		}
+	}
+	return uris
+}
+
+// pdfText returns the text of the strings shown in data, strings of the same array, in which a line is often split,
+// being joined together
+func pdfText(data []byte) []byte {
+	var text bytes.Buffer
+	inArray := false
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '[':
+			inArray = true
+		case ']':
+			inArray = false
+			text.WriteByte(' ')
+		case '(':
+			s, end := pdfLiteral(data, i)
+			text.Write(s)
+			if !inArray {
+				text.WriteByte(' ')
+			}
+			i = end
+		}
+	}
+	return text.Bytes()
+}
+
+// pdfLiteral returns the decoded literal string starting at data[start], which is its opening parenthesis, and the
+// index of its closing parenthesis
+func pdfLiteral(data []byte, start int) ([]byte, int) {
+	var s []byte
+	depth := 0
+	for i := start + 1; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '\\' && i+1 < len(data):
+			i++
+			switch e := data[i]; e {
+			case 'n':
+				s = append(s, '\n')
+			case 'r':
+				s = append(s, '\r')
+			case 't':
+				s = append(s, '\t')
+			case 'b':
+				s = append(s, '\b')
+			case 'f':
+				s = append(s, '\f')
+			case '\r', '\n':
+				// A line continuation
+				if e == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+			default:
+				if e < '0' || e > '7' {
+					s = append(s, e)
+					break
+				}
+				// Up to three octal digits
+				v := 0
+				for n := 0; n < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; n++ {
+					v = v*8 + int(data[i]-'0')
+					i++
+				}
+				i--
+				s = append(s, byte(v))
+			}
+		case c == '(':
+			depth++
+			s = append(s, c)
+		case c == ')':
+			if depth == 0 {
+				return s, i
+			}
+			depth--
+			s = append(s, c)
+		default:
+			s = append(s, c)
+		}
+	}
+	return s, len(data)
+}
+
+// pdfHex returns the decoded hexadecimal string starting at data[start], which is its opening angle bracket
+func pdfHex(data []byte, start int) []byte {
+	var s []byte
+	digits := make([]byte, 0, 2)
+	for i := start + 1; i < len(data) && data[i] != '>'; i++ {
+		c := data[i]
+		switch {
+		case c >= '0' && c <= '9':
+			digits = append(digits, c-'0')
+		case c >= 'a' && c <= 'f':
+			digits = append(digits, c-'a'+10)
+		case c >= 'A' && c <= 'F':
+			digits = append(digits, c-'A'+10)
+		default:
+			continue
+		}
+		if len(digits) == 2 {
+			s = append(s, digits[0]<<4|digits[1])
+			digits = digits[:0]
+		}
+	}
+	// A missing last digit is 0
+	if len(digits) == 1 {
+		s = append(s, digits[0]<<4)
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package crawl
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// deflate returns data compressed with zlib
+func deflate(data string) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	_, _ = w.Write([]byte(data))
+	_ = w.Close()
+	return b.String()
+}
+
+// testPDF returns a PDF document with link annotations and URLs in the text of its pages, some of them compressed
+func testPDF() []byte {
+	content := `BT /F1 12 Tf 72 712 Td (Read https://example.com/guide.) Tj ET`
+	compressed := `BT /F1 12 Tf 72 700 Td [(See http://exa) -20 (mple.com/split) 5 ( for more)] TJ ET`
+	objects := deflate(`<< /Type /Annot /Subtype /Link /A << /S /URI /URI (/docs/\(v2\)) >> >>`)
+	image := deflate(`(http://example.com/not-an-image-link)`)
+
+	return []byte(fmt.Sprintf(`%%PDF-1.5
+1 0 obj << /Type /Annot /Subtype /Link /Rect [0 0 10 10] /A << /S /URI /URI (https://example.com/annot\
+ation) >> >> endobj
+2 0 obj << /Type /Annot /Subtype /Link /A << /S /URI /URI <68747470733A2F2F6578616D706C652E636F6D2F686578> >> >>
+endobj
+3 0 obj << /Length %d >>
+stream
+%s
+endstream
+endobj
+4 0 obj << /Length %d /Filter /FlateDecode >>
+stream
+%s
+endstream
+endobj
+5 0 obj << /Type /ObjStm /N 1 /First 0 /Length %d /Filter /FlateDecode >>
+stream
+%s
+endstream
+endobj
+6 0 obj << /Type /XObject /Subtype /Image /Filter [/FlateDecode /DCTDecode] /Length %d >>
+stream
+%s
+endstream
+endobj
+%%%%EOF
+`, len(content), content, len(deflate(compressed)), deflate(compressed), len(objects), objects, len(image), image))
+}
+
+// TestExtractPDF verifies links are found in annotations and texts, compressed or not
+func TestExtractPDF(t *testing.T) {
+	links, err := extractPDF("https://example.com/files/doc.pdf", bytes.NewReader(testPDF()))
+	assert.NoError(t, err)
+	assert.Subset(t, links, []string{
+		"https://example.com/annotation",
+		"https://example.com/hex",
+		"https://example.com/guide",
+		"http://example.com/split",
+		"/docs/(v2)",
+	})
+	assert.NotContains(t, links, "http://example.com/not-an-image-link")
+}
+
+// TestPDFChunksBudget verifies compressed streams stop being inflated once the budget is spent
+func TestPDFChunksBudget(t *testing.T) {
+	bomb := deflate(string(make([]byte, 1000)))
+	var doc bytes.Buffer
+	for i := 0; i < 5; i++ {
+		_, _ = fmt.Fprintf(&doc, "%d 0 obj << /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream\nendobj\n",
+			i, len(bomb), bomb)
+	}
+
+	var inflated int
+	chunks := pdfChunks(doc.Bytes(), 2500)
+	for _, chunk := range chunks[1:] {
+		inflated += len(chunk)
+	}
+	assert.Len(t, chunks, 4)
+	assert.Equal(t, 2500, inflated)
+}
+
+// TestPDFLiteral verifies escapes and nested parentheses of literal strings are decoded
+func TestPDFLiteral(t *testing.T) {
+	data := []byte(`(a\(b\) (c) \n\\\101\60x\
+y) rest`)
+	s, end := pdfLiteral(data, 0)
+	assert.Equal(t, "a(b) (c) \n\\A0xy", string(s))
+	assert.Equal(t, byte(')'), data[end])
+
+	assert.Equal(t, "hi\xa0", string(pdfHex([]byte("<68 69a>"), 0)))
+}
+
+// TestCrawlPDF verifies links found in PDF documents are followed
+func TestCrawlPDF(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/files/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write(bytes.Replace(testPDF(), []byte("https://example.com"), []byte("http://"+r.Host), -1))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = fmt.Fprint(w, `<a href="/files/doc.pdf">doc</a>`)
+		}
+	}))
+	defer site.Close()
+
+	var visited []string
+	for _, res := range runCrawl(site.URL, getTestConfig()) {
+		visited = append(visited, res.URL)
+	}
+	sort.Strings(visited)
+	assert.Equal(t, []string{
+		site.URL,
+		site.URL + "/annotation",
+		site.URL + "/docs/(v2)",
+		site.URL + "/files/doc.pdf",
+		site.URL + "/guide",
+	}, visited)
+}
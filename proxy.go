@@ -0,0 +1,115 @@
+package crawl
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// proxyDirect is the keyword used in proxy rules for hosts that must be reached without proxy
+const proxyDirect = "direct"
+
+// proxies selects the proxy a request goes through : the one set for its host, or the default one
+type proxies struct {
+	fallback func(*http.Request) (*url.URL, error)
+	hosts    map[string]*url.URL // a nil proxy means a direct connection
+}
+
+// newProxies returns the proxy selection set by the configuration. Without a configured proxy, the HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY environment variables are used.
+func newProxies(conf *config) (*proxies, error) {
+	p := &proxies{
+		fallback: http.ProxyFromEnvironment,
+		hosts:    make(map[string]*url.URL),
+	}
+
+	if conf.Transport.Proxy != "" {
+		proxy, err := ParseProxy(conf.Transport.Proxy, conf.Transport.ProxyUsername, conf.Transport.ProxyPassword)
+		if err != nil {
+			return nil, err
+		}
+		p.fallback = http.ProxyURL(proxy)
+	}
+
+	for _, rule := range strings.Split(conf.Transport.ProxyRules, headerSeparator) {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		host, proxy, err := ParseProxyRule(rule, conf.Transport.ProxyUsername, conf.Transport.ProxyPassword)
+		if err != nil {
+			return nil, err
+		}
+		p.hosts[host] = proxy
+	}
+
+	return p, nil
+}
+
+// ParseProxy returns the url of the proxy, as in the configuration, with the given credentials if it has none, or nil
+// if it is "direct". Errors don't contain the proxy url, which may hold credentials.
+func ParseProxy(proxy, username, password string) (*url.URL, error) {
+	proxy = strings.TrimSpace(proxy)
+	if strings.EqualFold(proxy, proxyDirect) {
+		return nil, nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.New("Invalid proxy url")
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, errors.Errorf("Unsupported proxy scheme '%s', expected http, https or socks5", u.Scheme)
+	}
+
+	if u.User == nil && username != "" {
+		u.User = url.UserPassword(username, password)
+	}
+
+	return u, nil
+}
+
+// ParseProxyRule returns the host and proxy of a rule given as "host=proxy" or "host=direct", as in the configuration,
+// the proxy being nil for direct connections
+func ParseProxyRule(rule, username, password string) (string, *url.URL, error) {
+	hp := strings.SplitN(rule, "=", 2)
+	host := strings.TrimSpace(hp[0])
+	if len(hp) != 2 || host == "" {
+		return "", nil, errors.Errorf("Invalid proxy rule '%s', expected 'host=proxy' or 'host=%s'", rule, proxyDirect)
+	}
+	proxy, err := ParseProxy(hp[1], username, password)
+	if err != nil {
+		return "", nil, err
+	}
+	return host, proxy, nil
+}
+
+// proxy is used as the http.Transport's Proxy function. Rules for a host also apply to its subdomains when given with
+// a leading dot, e.g. ".example.com", the longest matching domain winning.
+func (p *proxies) proxy(req *http.Request) (*url.URL, error) {
+	host := req.URL.Hostname()
+	if proxy, ok := p.hosts[host]; ok {
+		return proxy, nil
+	}
+
+	match := ""
+	for domain := range p.hosts {
+		if strings.HasPrefix(domain, ".") && strings.HasSuffix(host, domain) && len(domain) > len(match) {
+			match = domain
+		}
+	}
+	if match != "" {
+		return p.hosts[match], nil
+	}
+
+	return p.fallback(req)
+}
+
+// setHost routes requests to host through proxy, or directly if proxy is nil
+func (p *proxies) setHost(host string, proxy *url.URL) {
+	p.hosts[host] = proxy
+}
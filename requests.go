@@ -1,107 +1,252 @@
 package crawl
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
-// todo comments
-func cancellableRequest(ctx context.Context, client *http.Client, req *http.Request,
-	respChan chan<- io.ReadCloser, errChan chan<- error) {
-	// Send request
-	resp, err := client.Do(req)
+var (
+	errRedirectLoop       = errors.New("redirect loop detected")
+	errTooManyRedirects   = errors.New("maximum number of redirects reached")
+	errRedirectOutOfScope = errors.New("redirect leaves the crawling scope")
+)
+
+// defaultMaxRedirects is the number of redirections followed when it is not configured
+const defaultMaxRedirects = 10
+
+// Redirect describes a single hop in a redirection chain
+type Redirect struct {
+	URL      string // URL that answered with a redirection
+	Status   int    // status code of the redirection
+	Location string // absolute target of the redirection
+}
+
+// redirectKey is the context key under which a request's redirectTracker is stored
+type redirectKey struct{}
+
+// redirectTracker records the redirection hops of a single request and enforces its limits
+type redirectTracker struct {
+	host    string // if not empty, redirections to other hosts are not followed
+	max     int
+	headers *headers
+	chain   []Redirect
+}
+
+// checkRedirect is used as the http.Client's CheckRedirect policy. It records every hop in the redirectTracker found
+// in the request's context, and stops on loops, on too many redirections, or when a redirection leaves the scope.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	tracker, ok := req.Context().Value(redirectKey{}).(*redirectTracker)
+	if !ok {
+		return nil
+	}
+
+	previous := via[len(via)-1]
+	hop := Redirect{
+		URL:      previous.URL.String(),
+		Location: req.URL.String(),
+	}
+	if req.Response != nil {
+		hop.Status = req.Response.StatusCode
+	}
+	tracker.chain = append(tracker.chain, hop)
+
+	// Don't follow if it is outside of the scope or following is disabled, but keep the redirection response
+	if tracker.max < 0 {
+		log.WithField("url", hop.URL).Tracef("Not following redirect to %s : redirections are disabled.", hop.Location)
+		return http.ErrUseLastResponse
+	}
+	if tracker.host != "" && req.URL.Host != tracker.host {
+		log.WithField("url", hop.URL).Tracef("Not following redirect to %s : %s.", hop.Location, errRedirectOutOfScope)
+		return http.ErrUseLastResponse
+	}
 
-	var bodyClose = func() {
-		if resp != nil {
-			_ = resp.Body.Close()
+	for _, r := range via {
+		if r.URL.String() == hop.Location {
+			return errRedirectLoop
 		}
 	}
 
-	select {
-	case <-ctx.Done(): // Cancelled
-		bodyClose()
-		return
-	default: // Success or timeout
-		break
+	if len(via) > tracker.max {
+		return errTooManyRedirects
 	}
 
-	if err != nil {
-		errChan <- errors.Wrapf(err, "Error in downloading resource")
-	} else {
-		respChan <- resp.Body
+	if tracker.headers != nil {
+		tracker.headers.redirect(req, previous)
 	}
+
+	return nil
 }
 
-// private scrapLinks with additional argument to indicate cancellation
+// isRedirectError returns whether the error was caused by a redirection policy, in which case retrying is pointless
+func isRedirectError(err error) bool {
+	cause := errors.Cause(err)
+	if uerr, ok := cause.(*url.Error); ok {
+		cause = uerr.Err
+	}
+	return cause == errRedirectLoop || cause == errTooManyRedirects
+}
 
-// todo : explanations
-// make get requests that are cancellable in-flight
-// if returns error, all others are nil
-// either errChan xor respChan send a message,
-// if no error, then body from respChan must be closed
-func cancellableDownload(url string, timeout time.Duration) (
-	<-chan io.ReadCloser, <-chan error, context.CancelFunc, error) {
-	// Build request and client
+// download sends a GET request for url with the configured headers through the fetcher, and returns the response
+// once all redirections are followed. If url was indexed by the previous crawl, the request is conditional.
+// Redirections are recorded in tracker. The request, including the reading of the response body, is aborted as soon as
+// ctx is cancelled. If there is no error, the caller must close the response body.
+func download(ctx context.Context, url string, params *parameters, tracker *redirectTracker) (*http.Response, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return nil, nil, nil, errors.Wrapf(err, "Could not make a GET Request for %s", url)
-	}
-	var client = &http.Client{
-		Timeout: timeout,
+		return nil, errors.Wrapf(err, "Could not make a GET Request for %s", url)
 	}
-	var ctx context.Context
-	var cancel context.CancelFunc
-
-	respChan := make(chan io.ReadCloser)
-	errChan := make(chan error)
+	req = req.WithContext(context.WithValue(ctx, redirectKey{}, tracker))
+	req.Header = params.headers.forHost(req.URL.Hostname())
+	setConditionalHeaders(req, params.previous.page(url))
 
-	ctx, cancel = context.WithCancel(context.Background())
-	req = req.WithContext(ctx)
+	resp, err := params.pageFetcher().Fetch(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error in downloading resource")
+	}
+	if resp.Request == nil {
+		resp.Request = req
+	}
 
-	// Send request
-	go cancellableRequest(ctx, client, req, respChan, errChan)
+	return resp, nil
+}
 
-	return respChan, errChan, cancel, nil
+// cancellableScrapLinks returns the links found in the web page pointed to by url.
+// If ctx is cancelled before the page is processed, it returns nil, nil.
+func cancellableScrapLinks(ctx context.Context, url string, params *parameters) ([]string, error) {
+	res, err := cancellableScrap(ctx, url, params)
+	if res == nil || err != nil {
+		return nil, err
+	}
+	return *res.Links, nil
 }
 
-// scrapLinks returns the links found in the web page pointed to by url
-// todo : add statement that if stop is given closed, it will return nil, nil
-func cancellableScrapLinks(url string, timeout time.Duration, stop <-chan struct{}) ([]string, error) {
+// cancellableScrap retrieves the web page pointed to by url and returns a LinkMap with the links it contains,
+// resolved against the URL the page was finally retrieved from. Redirections are followed up to params.maxRedirects,
+// none if it is negative, but not to another host than params.domain, if set. The returned LinkMap holds the redirection chain even on error.
+// If ctx is cancelled before the page is processed, it returns nil, nil. In any case, the response body is closed
+// before returning.
+func cancellableScrap(ctx context.Context, url string, params *parameters) (*LinkMap, error) {
 	// If stop was already ordered, quit immediately
-	select {
-	case <-stop:
+	if ctx.Err() != nil {
 		return nil, nil
-	default:
 	}
 
-	// If stop is not a nil channel, we want to be it cancellable
-	respChan, errChan, cancel, err := cancellableDownload(url, timeout)
+	tracker := &redirectTracker{host: "", max: params.maxRedirects, headers: params.headers}
+	if params.domain != nil {
+		tracker.host = params.domain.Host
+	}
+
+	res := newLinkMap(url, nil)
+
+	start := time.Now()
+	resp, err := download(ctx, url, params, tracker)
+	if ctx.Err() == nil {
+		params.metrics.RequestLatency(time.Since(start))
+	}
 	if err != nil {
-		return nil, err
+		// We were asked to stop
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+		res.Redirects = tracker.chain
+		return res, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	res.FinalURL = resp.Request.URL.String()
+	res.Status = resp.StatusCode
+	res.ETag = resp.Header.Get("ETag")
+	res.LastModified = resp.Header.Get("Last-Modified")
+	res.Redirects = tracker.chain
+
+	// Retrieve links, relative to where the page actually is
+	links := make([]string, 0)
+	switch {
+	case res.Status < 300:
+		links, err = scrapBody(res, resp.Body, resp.Header, params)
+	case res.Status >= 400:
+		page := params.extract(res.FinalURL, resp.Header.Get("Content-Type"), resp.Body)
+		links, res.Title = followLinks(res, page, resp.Header, params.ignoreRobots), page.title
+	}
+
+	if sizer, ok := resp.Body.(bodySizer); ok {
+		res.TransferSize, res.BodySize = sizer.sizes()
 	}
 
-	select {
-	// We need to stop / cancel request
-	case <-stop:
-		cancel()
+	// Reading the body is interrupted on cancellation, and links may be incomplete
+	if ctx.Err() != nil {
 		return nil, nil
+	}
+	if err != nil {
+		return res, errors.Wrap(err, "Error in downloading resource")
+	}
 
-	// We have a result
-	case body := <-respChan:
-		defer func() {
-			if body != nil {
-				_ = body.Close()
-			}
-		}()
-		// Retrieve links
-		return extractLinks(url, body), nil
-
-	// Request encountered an error
-	case err := <-errChan:
-		return nil, err
+	res.Links = &links
+	return res, nil
+}
+
+// scrapBody extracts the links and content of a successfully retrieved page into res, and returns the links to follow.
+// The whole body is read to be hashed, and mirrored if asked for. When skipping the links of duplicates, the body is
+// read before extracting links, which are not extracted if another page already had the same content.
+func scrapBody(res *LinkMap, body io.Reader, header http.Header, params *parameters) ([]string, error) {
+	hasher := sha256.New()
+	var content bytes.Buffer
+	var sink io.Writer = hasher
+	if params.mirror != nil {
+		sink = io.MultiWriter(hasher, &content)
 	}
+	body = io.TeeReader(body, sink)
+
+	var page *pageContent
+	if params.contents != nil {
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		res.ContentHash = hex.EncodeToString(hasher.Sum(nil))
+
+		if first := params.contents.claim(res.ContentHash, res.FinalURL); first != res.FinalURL {
+			log.WithField("url", res.URL).Tracef("Not extracting links, same content as %s.", first)
+			res.DuplicateOf = first
+			page = &pageContent{links: []string{}, nofollow: nil, title: "", words: nil, info: nil}
+		} else {
+			page = params.extract(res.FinalURL, header.Get("Content-Type"), bytes.NewReader(data))
+		}
+	} else {
+		page = params.extract(res.FinalURL, header.Get("Content-Type"), body)
+
+		// The extractor may have stopped before the end of the body
+		if _, err := io.Copy(ioutil.Discard, body); err != nil {
+			return nil, err
+		}
+		res.ContentHash = hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	res.Title = page.title
+	res.SimHash = simHash(page.words)
+	if page.info != nil {
+		res.Canonical = page.info.Canonical
+	}
+	if params.pageInfo {
+		res.Info = page.info
+	}
+
+	if params.mirror != nil {
+		if err := params.mirror.save(res.FinalURL, header.Get("Content-Type"), content.Bytes()); err != nil {
+			log.WithField("url", res.FinalURL).Errorf("Could not mirror page : %s", err)
+		}
+	}
+
+	return followLinks(res, page, header, params.ignoreRobots), nil
 }
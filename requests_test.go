@@ -0,0 +1,233 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newRedirectServer returns a test server serving a small site with redirections
+func newRedirectServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/middle", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/middle", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/dir/final", http.StatusFound)
+	})
+	mux.HandleFunc("/dir/final", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `<html><body><a href="page">relative</a></body></html>`)
+	})
+	mux.HandleFunc("/loop-a", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop-b", http.StatusFound)
+	})
+	mux.HandleFunc("/loop-b", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop-a", http.StatusFound)
+	})
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com/elsewhere", http.StatusMovedPermanently)
+	})
+	return httptest.NewServer(mux)
+}
+
+// TestCancellableScrapRedirects verifies redirection chains are recorded and links resolved against the final URL
+func TestCancellableScrapRedirects(t *testing.T) {
+	server := newRedirectServer()
+	defer server.Close()
+	params := getTestParameters(3 * time.Second)
+
+	res, err := cancellableScrap(context.Background(), server.URL+"/start", params)
+	if err != nil {
+		t.Fatalf("cancellableScrap() should follow redirections : %s", err)
+	}
+
+	expected := []Redirect{
+		{server.URL + "/start", http.StatusMovedPermanently, server.URL + "/middle"},
+		{server.URL + "/middle", http.StatusFound, server.URL + "/dir/final"},
+	}
+	assert.Equal(t, expected, res.Redirects)
+	assert.Equal(t, server.URL+"/dir/final", res.FinalURL)
+	assert.Equal(t, http.StatusOK, res.Status)
+	assert.ElementsMatch(t, []string{server.URL + "/dir/page"}, *res.Links)
+}
+
+// TestCancellableScrapRedirectsFail verifies loops and redirection limits
+func TestCancellableScrapRedirectsFail(t *testing.T) {
+	server := newRedirectServer()
+	defer server.Close()
+	params := getTestParameters(3 * time.Second)
+
+	res, err := cancellableScrap(context.Background(), server.URL+"/loop-a", params)
+	if !isRedirectError(err) {
+		t.Errorf("cancellableScrap() should detect redirect loops : %v", err)
+	}
+	if res == nil || len(res.Redirects) != 2 {
+		t.Errorf("cancellableScrap() should report the redirect loop's chain : %v", res)
+	}
+
+	params.maxRedirects = 1
+	_, err = cancellableScrap(context.Background(), server.URL+"/start", params)
+	if !isRedirectError(err) {
+		t.Errorf("cancellableScrap() should not follow more redirections than allowed : %v", err)
+	}
+
+	// With redirections disabled, the first one is reported as is
+	params.maxRedirects = -1
+	res, err = cancellableScrap(context.Background(), server.URL+"/start", params)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusMovedPermanently, res.Status)
+	assert.Equal(t, server.URL+"/start", res.FinalURL)
+	assert.Equal(t, []Redirect{{server.URL + "/start", http.StatusMovedPermanently, server.URL + "/middle"}}, res.Redirects)
+}
+
+// TestCancellableScrapRedirectScope verifies redirections leaving the scope are recorded but not followed
+func TestCancellableScrapRedirectScope(t *testing.T) {
+	server := newRedirectServer()
+	defer server.Close()
+	params := getTestParameters(3 * time.Second)
+	params.domain, _ = url.Parse(server.URL)
+
+	res, err := cancellableScrap(context.Background(), server.URL+"/away", params)
+	if err != nil {
+		t.Fatalf("cancellableScrap() should not fail on out of scope redirections : %s", err)
+	}
+
+	assert.Equal(t, http.StatusMovedPermanently, res.Status)
+	assert.Equal(t, server.URL+"/away", res.FinalURL)
+	assert.Equal(t, []Redirect{{server.URL + "/away", http.StatusMovedPermanently, "https://example.com/elsewhere"}},
+		res.Redirects)
+	assert.Empty(t, *res.Links)
+}
+
+// newBlockingServer returns a test server whose handlers block until their request is aborted by the client.
+// If partial is true, the handlers send the beginning of a page before blocking. Every entered handler is signalled
+// on entered, and every aborted request on aborted.
+func newBlockingServer(partial bool, entered, aborted chan<- struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if partial {
+			_, _ = fmt.Fprint(w, `<html><body><a href="/a">a</a>`)
+			w.(http.Flusher).Flush()
+		}
+		entered <- struct{}{}
+		<-r.Context().Done()
+		aborted <- struct{}{}
+	}))
+}
+
+// checkGoroutines waits for the number of goroutines to go down to at most n, and fails the test if it doesn't
+func checkGoroutines(t *testing.T, n int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Errorf("%d goroutines are left running, expected %d :\n%s", runtime.NumGoroutine(), n,
+				buf[:runtime.Stack(buf, true)])
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestCancellableScrapCancel verifies that cancelling a request, while waiting for the response or reading the body,
+// returns immediately, aborts the connection, and leaves no goroutine behind
+func TestCancellableScrapCancel(t *testing.T) {
+	for _, partial := range []bool{false, true} {
+		entered := make(chan struct{}, 1)
+		aborted := make(chan struct{}, 1)
+		server := newBlockingServer(partial, entered, aborted)
+		params := getTestParameters(0)
+		baseline := runtime.NumGoroutine()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			res, err := cancellableScrap(ctx, server.URL, params)
+			if res != nil || err != nil {
+				t.Errorf("cancellableScrap() should return nil, nil on cancellation : %v, %v", res, err)
+			}
+		}()
+
+		select {
+		case <-entered:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("the request never reached the server (partial body : %v).", partial)
+		}
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("cancellableScrap() did not return on cancellation (partial body : %v).", partial)
+		}
+
+		select {
+		case <-aborted:
+		case <-time.After(2 * time.Second):
+			t.Errorf("cancellation did not abort the request (partial body : %v).", partial)
+		}
+
+		params.client.CloseIdleConnections()
+		checkGoroutines(t, baseline)
+		server.Close()
+	}
+}
+
+// TestQuitCrawlerCancel verifies that stopping the crawler aborts in-flight requests and leaves no worker behind
+func TestQuitCrawlerCancel(t *testing.T) {
+	workers := 5
+	entered := make(chan struct{}, workers)
+	aborted := make(chan struct{}, workers)
+	server := newBlockingServer(false, entered, aborted)
+	defer server.Close()
+
+	test := getTestData()
+	c, err := newCrawler(server.URL, test.syn.results, getTestParameters(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseline := runtime.NumGoroutine()
+
+	for i := 0; i < workers; i++ {
+		c.newTask(fmt.Sprintf("%s/%d", server.URL, i))
+	}
+	timeout := time.After(2 * time.Second)
+	for i := 0; i < workers; i++ {
+		select {
+		case <-entered:
+		case <-timeout:
+			t.Fatalf("only %d of %d requests reached the server.", i, workers)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.quitCrawler(test.syn)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("quitCrawler() did not return with requests in flight.")
+	}
+
+	timeout = time.After(2 * time.Second)
+	for i := 0; i < workers; i++ {
+		select {
+		case <-aborted:
+		case <-timeout:
+			t.Fatalf("quitCrawler() only aborted %d of %d requests.", i, workers)
+		}
+	}
+
+	c.client.CloseIdleConnections()
+	checkGoroutines(t, baseline)
+}
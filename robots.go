@@ -0,0 +1,90 @@
+package crawl
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SkipReason tells why a link found on a page was not followed
+type SkipReason string
+
+// Robots directives a link may be skipped for
+const (
+	SkipNofollowLink SkipReason = "nofollow-link" // the link has a rel="nofollow" attribute
+	SkipMetaRobots   SkipReason = "meta-robots"   // the page has a robots meta tag with nofollow or none
+	SkipRobotsHeader SkipReason = "x-robots-tag"  // the response has a X-Robots-Tag header with nofollow or none
+)
+
+// SkippedLink is a link found on a page that was not followed, because of a robots directive
+type SkippedLink struct {
+	URL    string
+	Reason SkipReason
+}
+
+// robotsHeader is the response header holding robots directives
+const robotsHeader = "X-Robots-Tag"
+
+// robotsParameters are the robots directives that have a value after a colon, and are not a user agent name
+var robotsParameters = map[string]bool{
+	"unavailable_after": true,
+	"max-snippet":       true,
+	"max-image-preview": true,
+	"max-video-preview": true,
+}
+
+// isNofollow returns whether the comma separated robots directives forbid following links
+func isNofollow(directives string) bool {
+	for _, d := range strings.Split(strings.ToLower(directives), ",") {
+		if d = strings.TrimSpace(d); d == "nofollow" || d == "none" {
+			return true
+		}
+	}
+	return false
+}
+
+// headerNofollow returns whether a X-Robots-Tag header forbids following links. Directives addressed to a given user
+// agent, like 'googlebot: nofollow', are ignored.
+func headerNofollow(header http.Header) bool {
+	for _, value := range header[http.CanonicalHeaderKey(robotsHeader)] {
+		if i := strings.Index(value, ":"); i > 0 {
+			name := strings.ToLower(strings.TrimSpace(value[:i]))
+			if !robotsParameters[name] && !strings.Contains(name, ",") {
+				continue
+			}
+		}
+		if isNofollow(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// followLinks returns the links of page to follow, and reports the others in res.Skipped. Links marked rel="nofollow"
+// are skipped, and all of them are if the page or the response header forbids following links, unless robots
+// directives are ignored.
+func followLinks(res *LinkMap, page *pageContent, header http.Header, ignoreRobots bool) []string {
+	if ignoreRobots {
+		return append(page.links, page.nofollow...)
+	}
+
+	var reason SkipReason
+	switch {
+	case headerNofollow(header):
+		reason = SkipRobotsHeader
+	case page.info != nil && isNofollow(page.info.Robots):
+		reason = SkipMetaRobots
+	}
+
+	for _, link := range page.nofollow {
+		res.Skipped = append(res.Skipped, SkippedLink{URL: link, Reason: SkipNofollowLink})
+	}
+	if reason == "" {
+		return page.links
+	}
+
+	for _, link := range page.links {
+		res.Skipped = append(res.Skipped, SkippedLink{URL: link, Reason: reason})
+	}
+	log.WithField("url", res.URL).Tracef("Not following the %d links of the page : %s.", len(page.links), reason)
+	return []string{}
+}
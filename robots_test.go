@@ -0,0 +1,101 @@
+package crawl
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHeaderNofollow verifies which X-Robots-Tag headers forbid following links
+func TestHeaderNofollow(t *testing.T) {
+	tests := []struct {
+		values   []string
+		nofollow bool
+	}{
+		{nil, false},
+		{[]string{"noindex"}, false},
+		{[]string{"NoIndex, NoFollow"}, true},
+		{[]string{"none"}, true},
+		{[]string{"noarchive", "nofollow"}, true},
+		{[]string{"googlebot: nofollow"}, false},
+		{[]string{"unavailable_after: 25 Jun 2010 15:00:00 PST, nofollow"}, true},
+		{[]string{"noindex, max-snippet: 0, nofollow"}, true},
+	}
+
+	for _, test := range tests {
+		header := http.Header{robotsHeader: test.values}
+		assert.Equal(t, test.nofollow, headerNofollow(header), "%v", test.values)
+	}
+}
+
+// TestFollowLinks verifies links are skipped for the right reasons, and followed when ignoring directives
+func TestFollowLinks(t *testing.T) {
+	body := `<html><head><meta name="robots" content="%s"></head><body><a href="/a">a</a>` +
+		`<a href="/b" rel="external nofollow">b</a><a href="/c" rel="nofollow">c</a><a href="/c">c</a></body></html>`
+	origin := "https://example.com"
+	page := func(robots string) *pageContent {
+		return extractPage(origin, strings.NewReader(fmt.Sprintf(body, robots)), false)
+	}
+
+	res := newLinkMap(origin, nil)
+	links := followLinks(res, page("index"), http.Header{}, false)
+	sort.Strings(links)
+	assert.Equal(t, []string{origin + "/a", origin + "/c"}, links)
+	assert.Equal(t, []SkippedLink{{URL: origin + "/b", Reason: SkipNofollowLink}}, res.Skipped)
+
+	res = newLinkMap(origin, nil)
+	assert.Empty(t, followLinks(res, page("noindex, nofollow"), http.Header{}, false))
+	assert.Len(t, res.Skipped, 3)
+	assert.Contains(t, res.Skipped, SkippedLink{URL: origin + "/a", Reason: SkipMetaRobots})
+
+	res = newLinkMap(origin, nil)
+	assert.Empty(t, followLinks(res, page("none"), http.Header{robotsHeader: {"nofollow"}}, false))
+	assert.Contains(t, res.Skipped, SkippedLink{URL: origin + "/c", Reason: SkipRobotsHeader})
+
+	res = newLinkMap(origin, nil)
+	assert.Len(t, followLinks(res, page("nofollow"), http.Header{robotsHeader: {"nofollow"}}, true), 3)
+	assert.Nil(t, res.Skipped)
+}
+
+// TestCrawlRobots verifies links are not followed when directives forbid it, unless ignored
+func TestCrawlRobots(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			_, _ = fmt.Fprint(w, `<a href="/meta">meta</a><a href="/header">header</a><a href="/hidden" rel="nofollow">h</a>`)
+		case "/meta":
+			_, _ = fmt.Fprint(w, `<meta name="robots" content="nofollow"><a href="/from-meta">link</a>`)
+		case "/header":
+			w.Header().Set(robotsHeader, "nofollow")
+			_, _ = fmt.Fprint(w, `<a href="/from-header">link</a>`)
+		default:
+			_, _ = fmt.Fprint(w, `<p>leaf</p>`)
+		}
+	}))
+	defer site.Close()
+
+	visited := func(results []*LinkMap) map[string]*LinkMap {
+		pages := make(map[string]*LinkMap)
+		for _, res := range results {
+			pages[strings.TrimPrefix(res.URL, site.URL)] = res
+		}
+		return pages
+	}
+
+	pages := visited(runCrawl(site.URL, getTestConfig()))
+	assert.Len(t, pages, 3)
+	assert.Equal(t, []SkippedLink{{URL: site.URL + "/hidden", Reason: SkipNofollowLink}}, pages[""].Skipped)
+	assert.Equal(t, []SkippedLink{{URL: site.URL + "/from-meta", Reason: SkipMetaRobots}}, pages["/meta"].Skipped)
+	assert.Equal(t, []SkippedLink{{URL: site.URL + "/from-header", Reason: SkipRobotsHeader}}, pages["/header"].Skipped)
+
+	pages = visited(runCrawl(site.URL, getTestConfig(), WithIgnoreRobots()))
+	assert.Len(t, pages, 6)
+	assert.Contains(t, pages, "/hidden")
+	assert.Contains(t, pages, "/from-meta")
+	assert.Contains(t, pages, "/from-header")
+}
@@ -0,0 +1,223 @@
+package crawl
+
+import (
+	"hash/fnv"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	dedupExact = "exact"
+	dedupBloom = "bloom"
+
+	// bloomMinCapacity is the capacity of the first filter of a scalable Bloom filter
+	bloomMinCapacity = 1 << 16
+
+	// bloomGrowth is the capacity ratio between a filter and the previous one
+	bloomGrowth = 2
+
+	// bloomTightening is the false positive rate ratio between a filter and the previous one. The compound rate of
+	// all filters is bounded by the first filter's rate divided by 1 - bloomTightening.
+	bloomTightening = 0.5
+)
+
+// seenSet holds every link the crawler already came across, to discover each link only once
+type seenSet interface {
+	// add adds link to the set
+	add(link string)
+
+	// has returns whether link is in the set. It may wrongly return true for a probabilistic set, but never false for
+	// a link that was added.
+	has(link string) bool
+
+	// len returns the number of links added to the set
+	len() int
+}
+
+// newSeenSet returns the seen set for the dedup mode. In exact mode, links are kept in store, so that they are on disk
+// with a disk-backed store. In bloom mode, links are kept exactly in memory until there are more than threshold links,
+// after which they are kept in a scalable Bloom filter with the given false positive rate.
+func newSeenSet(mode string, falsePositive float64, threshold int, store StateStore) seenSet {
+	if mode != dedupBloom {
+		return storedSet{states: linkStates{store: store}}
+	}
+	return &adaptiveSet{
+		seenSet:       newExactSet(),
+		threshold:     threshold,
+		falsePositive: falsePositive,
+	}
+}
+
+// checkFalsePositive returns an error if rate is not a usable false positive rate for a Bloom filter : at 0 it would
+// need infinite memory, and from 1 on it would take every link for already seen
+func checkFalsePositive(rate float64) error {
+	if !(rate > 0 && rate < 1) {
+		return errors.Errorf("Invalid false positive rate %v for the Bloom filter, expected between 0 and 1 excluded", rate)
+	}
+	return nil
+}
+
+// storedSet is a seenSet keeping the links in the state store
+type storedSet struct {
+	states linkStates
+}
+
+func (s storedSet) add(link string) {
+	s.states.put(SeenSet, link, 1)
+}
+
+func (s storedSet) has(link string) bool {
+	return s.states.has(SeenSet, link)
+}
+
+func (s storedSet) len() int {
+	return s.states.count(SeenSet)
+}
+
+// exactSet is a seenSet keeping the links themselves in memory
+type exactSet map[string]struct{}
+
+// newExactSet returns an empty exactSet
+func newExactSet() exactSet {
+	return make(exactSet)
+}
+
+func (e exactSet) add(link string) {
+	e[link] = struct{}{}
+}
+
+func (e exactSet) has(link string) bool {
+	_, ok := e[link]
+	return ok
+}
+
+func (e exactSet) len() int {
+	return len(e)
+}
+
+// adaptiveSet is an exact set until it holds more than threshold links, after which it switches to a scalable
+// Bloom filter, trading exactness for memory.
+type adaptiveSet struct {
+	seenSet
+	threshold     int
+	falsePositive float64
+}
+
+func (a *adaptiveSet) add(link string) {
+	a.seenSet.add(link)
+
+	exact, ok := a.seenSet.(exactSet)
+	if !ok || exact.len() <= a.threshold {
+		return
+	}
+
+	capacity := 2 * exact.len()
+	if capacity < bloomMinCapacity {
+		capacity = bloomMinCapacity
+	}
+	bloom := newScalableBloom(capacity, a.falsePositive)
+	for l := range exact {
+		bloom.add(l)
+	}
+	a.seenSet = bloom
+	log.Infof("Switched link deduplication to a Bloom filter after %d links.", exact.len())
+}
+
+// bloomFilter is a fixed size Bloom filter
+type bloomFilter struct {
+	bits     []uint64
+	m        uint64  // number of bits
+	k        uint64  // number of hash functions
+	n        int     // number of links added
+	capacity int     // number of links after which the false positive rate is exceeded
+	rate     float64 // false positive rate at capacity
+}
+
+// newBloomFilter returns a Bloom filter that holds capacity links with the false positive rate
+func newBloomFilter(capacity int, falsePositive float64) *bloomFilter {
+	m := math.Ceil(-float64(capacity) * math.Log(falsePositive) / (math.Ln2 * math.Ln2))
+	k := math.Ceil(math.Ln2 * m / float64(capacity))
+	words := (uint64(m) + 63) / 64
+
+	return &bloomFilter{
+		bits:     make([]uint64, words),
+		m:        words * 64,
+		k:        uint64(k),
+		n:        0,
+		capacity: capacity,
+		rate:     falsePositive,
+	}
+}
+
+// bloomHashes returns the two base hashes of link, from which the filters' hash functions are derived
+func bloomHashes(link string) (h1, h2 uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(link))
+	h1 = h.Sum64()
+	// Mix the first hash to derive an independent second one, kept odd to cover all bit positions
+	h2 = (h1 ^ (h1 >> 33)) * 0xff51afd7ed558ccd
+	h2 = (h2 ^ (h2 >> 33)) | 1
+	return h1, h2
+}
+
+func (b *bloomFilter) add(h1, h2 uint64) {
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+	b.n++
+}
+
+func (b *bloomFilter) has(h1, h2 uint64) bool {
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// scalableBloom is a seenSet made of Bloom filters of growing capacity and decreasing false positive rate, so that
+// the compound false positive rate stays bounded however many links are added.
+type scalableBloom struct {
+	filters []*bloomFilter
+	n       int
+}
+
+// newScalableBloom returns a scalable Bloom filter starting with capacity, with a compound false positive rate
+// bounded by falsePositive
+func newScalableBloom(capacity int, falsePositive float64) *scalableBloom {
+	return &scalableBloom{
+		filters: []*bloomFilter{newBloomFilter(capacity, falsePositive*(1-bloomTightening))},
+		n:       0,
+	}
+}
+
+func (s *scalableBloom) add(link string) {
+	h1, h2 := bloomHashes(link)
+
+	last := s.filters[len(s.filters)-1]
+	if last.n >= last.capacity {
+		last = newBloomFilter(last.capacity*bloomGrowth, last.rate*bloomTightening)
+		s.filters = append(s.filters, last)
+	}
+
+	last.add(h1, h2)
+	s.n++
+}
+
+func (s *scalableBloom) has(link string) bool {
+	h1, h2 := bloomHashes(link)
+	for _, f := range s.filters {
+		if f.has(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scalableBloom) len() int {
+	return s.n
+}
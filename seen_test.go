@@ -0,0 +1,193 @@
+package crawl
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// generateLink returns the i-th link of a generated site
+func generateLink(i int) string {
+	return fmt.Sprintf("https://example.com/section-%d/page-%d?id=%d", i%97, i, i*7919)
+}
+
+// generateLinks returns the n first links of a generated site
+func generateLinks(n int) []string {
+	links := make([]string, n)
+	for i := range links {
+		links[i] = generateLink(i)
+	}
+	return links
+}
+
+// falsePositives returns the rate of links in probes that set wrongly has
+func falsePositives(set seenSet, probes []string) float64 {
+	n := 0
+	for _, link := range probes {
+		if set.has(link) {
+			n++
+		}
+	}
+	return float64(n) / float64(len(probes))
+}
+
+func TestExactSet(t *testing.T) {
+	store := newMemoryStore()
+	set := newSeenSet(dedupExact, 0.01, 0, store)
+	links := generateLinks(1000)
+	for _, link := range links {
+		set.add(link)
+	}
+	set.add(links[0])
+
+	assert.Equal(t, len(links), set.len())
+	for _, link := range links {
+		assert.True(t, set.has(link))
+	}
+	assert.Equal(t, 0.0, falsePositives(set, generateLinks(2000)[1000:]))
+
+	// Links are kept in the store, e.g. on disk
+	n, _ := store.Len(SeenSet)
+	assert.Equal(t, len(links), n)
+}
+
+func TestScalableBloom(t *testing.T) {
+	rate := 0.01
+	set := newScalableBloom(1000, rate)
+
+	// Adding ten times the initial capacity makes the filter grow
+	links := generateLinks(20000)
+	for _, link := range links[:10000] {
+		set.add(link)
+	}
+	assert.Equal(t, 10000, set.len())
+	if len(set.filters) < 2 {
+		t.Errorf("the filter should have grown past its capacity, has %d filters", len(set.filters))
+	}
+
+	// No false negatives
+	for _, link := range links[:10000] {
+		if !set.has(link) {
+			t.Fatalf("the filter should have %s", link)
+		}
+	}
+
+	// The compound false positive rate stays bounded
+	if fp := falsePositives(set, links[10000:]); fp > rate {
+		t.Errorf("false positive rate %f exceeds %f", fp, rate)
+	}
+}
+
+func TestAdaptiveSet(t *testing.T) {
+	set := newSeenSet(dedupBloom, 0.001, 100, newMemoryStore())
+	links := generateLinks(200)
+
+	for _, link := range links[:100] {
+		set.add(link)
+	}
+	assert.IsType(t, exactSet{}, set.(*adaptiveSet).seenSet)
+
+	for _, link := range links[100:] {
+		set.add(link)
+	}
+	assert.IsType(t, &scalableBloom{}, set.(*adaptiveSet).seenSet)
+	assert.Equal(t, len(links), set.len())
+	for _, link := range links {
+		assert.True(t, set.has(link))
+	}
+}
+
+// TestFilterLinks verifies links are only discovered once
+func TestFilterLinks(t *testing.T) {
+	test := getTestData()
+	c, err := newCrawler(test.urlValid, test.syn.results, getTestParameters(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"a", "b"}, c.filterLinks([]string{"a", "b"}))
+	assert.Equal(t, []string{"c"}, c.filterLinks([]string{"b", "c", "a"}))
+}
+
+// TestCrawlBloomFilter verifies a crawl deduplicating links with a Bloom filter visits all pages once
+func TestCrawlBloomFilter(t *testing.T) {
+	pages := map[string][]string{"/": {}}
+	for i := 0; i < 50; i++ {
+		page := fmt.Sprintf("/%d", i)
+		pages["/"] = append(pages["/"], page)
+		pages[page] = []string{"/", fmt.Sprintf("/%d", (i+1)%50)}
+	}
+	site := newSiteServer(pages)
+	defer site.Close()
+
+	results := runCrawl(site.URL, getTestConfig(), WithBloomFilter(0.0001, 10))
+
+	var visited []string
+	for _, res := range results {
+		visited = append(visited, strings.TrimPrefix(res.URL, site.URL))
+	}
+	sort.Strings(visited)
+	assert.Len(t, visited, 51)
+	for page := range pages {
+		assert.Equal(t, 1, site.hit(page), page)
+	}
+}
+
+// benchmarkSeenMemory reports the memory used per link by the set returned by newSet, once it holds b.N links,
+// including the links it keeps
+func benchmarkSeenMemory(b *testing.B, newSet func() seenSet) {
+	var before, after runtime.MemStats
+
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+
+	set := newSet()
+	for i := 0; i < b.N; i++ {
+		set.add(generateLink(i))
+	}
+
+	b.StopTimer()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/float64(b.N), "bytes/link")
+	runtime.KeepAlive(set)
+}
+
+// BenchmarkSeenExact measures the memory used by the exact seen set
+func BenchmarkSeenExact(b *testing.B) {
+	benchmarkSeenMemory(b, func() seenSet {
+		return newSeenSet(dedupExact, 0, 0, newMemoryStore())
+	})
+}
+
+// BenchmarkSeenBloom measures the memory used by a Bloom filter seen set with a 0.1% false positive rate
+func BenchmarkSeenBloom(b *testing.B) {
+	benchmarkSeenMemory(b, func() seenSet {
+		return newSeenSet(dedupBloom, 0.001, 0, newMemoryStore())
+	})
+}
+
+// TestBloomFilterRate verifies crawls don't start with false positive rates the Bloom filter can't work with
+func TestBloomFilterRate(t *testing.T) {
+	for _, rate := range []float64{0, -0.1, 1, 2, math.NaN()} {
+		_, err := newParameters(getTestConfig(), time.Second, WithBloomFilter(rate, 10))
+		assert.Error(t, err, rate)
+	}
+
+	params, err := newParameters(getTestConfig(), time.Second, WithBloomFilter(0.01, 10))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.01, params.falsePositive)
+
+	// The rate is not used when deduplicating exactly
+	conf := getTestConfig()
+	conf.Dedup.FalsePositive = 0
+	_, err = newParameters(conf, time.Second)
+	assert.NoError(t, err)
+}
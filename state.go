@@ -0,0 +1,216 @@
+package crawl
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// crawlState is the saved state of a crawl, from which it can be resumed
+type crawlState struct {
+	Domain  string         `json:"domain"`
+	Saved   time.Time      `json:"saved"`
+	Visited []string       `json:"visited"`
+	Failed  []string       `json:"failed"`
+	Pending map[string]int `json:"pending"` // number of attempts on links to visit, aborted ones excluded
+	Todo    []string       `json:"todo"`    // links waiting to be visited, in order, then those being visited
+	Depth   map[string]int `json:"depth"`   // depth of links to visit
+}
+
+// saveState writes the crawl state to the state file, if any. The previous state is only replaced once the new one
+// is completely written.
+func (c *crawler) saveState() error {
+	if c.stateFile == "" {
+		return nil
+	}
+
+	if err := writeFileAtomic(c.stateFile, c.writeState); err != nil {
+		return errors.Wrap(err, "Could not write crawl state")
+	}
+
+	log.WithField("file", c.stateFile).Tracef("Saved crawl state.")
+	return nil
+}
+
+// stateWriter writes the crawl state as JSON, value by value. Values can't fail to encode, and write errors are kept
+// by buf and returned on Flush, or by the encoder once the buffer is full.
+type stateWriter struct {
+	buf   *bufio.Writer
+	enc   *json.Encoder
+	first bool // nothing was written yet in the current array or object
+}
+
+// open writes the key of an array or an object, and its opening delimiter
+func (s *stateWriter) open(key string, delim byte) {
+	_, _ = s.buf.WriteString(`,"` + key + `":`)
+	_ = s.buf.WriteByte(delim)
+	s.first = true
+}
+
+// element writes a value of an array
+func (s *stateWriter) element(value interface{}) error {
+	if !s.first {
+		_ = s.buf.WriteByte(',')
+	}
+	s.first = false
+	return s.enc.Encode(value)
+}
+
+// member writes a key and its value of an object
+func (s *stateWriter) member(key string, value interface{}) error {
+	if err := s.element(key); err != nil {
+		return err
+	}
+	_ = s.buf.WriteByte(':')
+	return s.enc.Encode(value)
+}
+
+// writeState writes the crawl state to w, as JSON. Links are read from the store one by one, not to hold them all in
+// memory on large crawls. Links being visited are saved as waiting, without counting the attempt in progress. It must
+// be called from the crawling goroutine, since the todo queue is emptied and filled again.
+func (c *crawler) writeState(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	s := &stateWriter{buf: buf, enc: json.NewEncoder(buf), first: true}
+
+	_, _ = buf.WriteString(`{"domain":`)
+	_ = s.enc.Encode(c.domain.String())
+	_, _ = buf.WriteString(`,"saved":`)
+	_ = s.enc.Encode(time.Now())
+
+	for _, set := range []LinkSet{VisitedSet, FailedSet} {
+		s.open(set.String(), '[')
+		if err := c.store.ForEach(set, func(link string, _ int) error {
+			return s.element(link)
+		}); err != nil {
+			return errors.Wrap(err, "Could not list links")
+		}
+		_ = buf.WriteByte(']')
+	}
+
+	s.open("pending", '{')
+	if err := c.store.ForEach(PendingSet, func(link string, value int) error {
+		pending := newPendingLink(value)
+		if pending.visiting {
+			pending.attempts--
+		}
+		return s.member(link, pending.attempts)
+	}); err != nil {
+		return errors.Wrap(err, "Could not list pending links")
+	}
+	_ = buf.WriteByte('}')
+
+	s.open("todo", '[')
+	for n := len(c.todo); n > 0; n-- {
+		link := <-c.todo
+		c.todo <- link
+		_ = s.element(link)
+	}
+	if err := c.store.ForEachQueued(func(link string) error {
+		return s.element(link)
+	}); err != nil {
+		return errors.Wrap(err, "Could not list queued links")
+	}
+	if err := c.store.ForEach(PendingSet, func(link string, value int) error {
+		if newPendingLink(value).visiting {
+			return s.element(link)
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "Could not list pending links")
+	}
+	_ = buf.WriteByte(']')
+
+	s.open("depth", '{')
+	if err := c.store.ForEach(PendingSet, func(link string, value int) error {
+		return s.member(link, newPendingLink(value).depth)
+	}); err != nil {
+		return errors.Wrap(err, "Could not list pending links")
+	}
+	_, _ = buf.WriteString("}}")
+
+	return buf.Flush()
+}
+
+// writeFileAtomic writes to file with write. The previous file is only replaced once the new one is completely
+// written.
+func writeFileAtomic(file string, write func(w io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "Could not create temporary file")
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if err = write(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), file), "Could not replace file")
+}
+
+// loadState reads a crawl state from file
+func loadState(file string) (*crawlState, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var state crawlState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, errors.Wrapf(err, "Invalid crawl state file '%s'", file)
+	}
+
+	return &state, nil
+}
+
+// restoreState loads the saved crawl state into the crawler if resuming was asked for, and returns whether it did
+func (c *crawler) restoreState() (bool, error) {
+	if !c.resume || c.stateFile == "" {
+		return false, nil
+	}
+
+	state, err := loadState(c.stateFile)
+	if os.IsNotExist(errors.Cause(err)) {
+		log.WithField("file", c.stateFile).Info("No crawl state to resume from, starting from scratch.")
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if state.Domain != c.domain.String() {
+		return false, errors.Errorf("Crawl state in '%s' is for '%s', not '%s'", c.stateFile, state.Domain,
+			c.domain.String())
+	}
+
+	for _, link := range state.Visited {
+		c.put(VisitedSet, link, 1)
+		c.seen.add(link)
+	}
+	for _, link := range state.Failed {
+		c.put(FailedSet, link, 1)
+		c.seen.add(link)
+	}
+
+	for _, link := range state.Todo {
+		c.seen.add(link)
+		c.putPending(link, pendingLink{depth: state.Depth[link], attempts: state.Pending[link], visiting: false})
+		c.enqueue(link)
+	}
+
+	log.WithField("file", c.stateFile).Infof("Resuming crawl saved on %s : %d visited, %d to visit.",
+		state.Saved.Format(time.RFC3339), len(state.Visited), len(state.Todo))
+
+	return true, nil
+}
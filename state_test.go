@@ -0,0 +1,187 @@
+package crawl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// siteServer serves pages linking to each other, and counts the requests for each path
+type siteServer struct {
+	*httptest.Server
+	mutex sync.Mutex
+	hits  map[string]int
+}
+
+// newSiteServer returns a test server serving pages, given as the paths of their links, indexed by their path
+func newSiteServer(pages map[string][]string) *siteServer {
+	s := &siteServer{hits: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		s.hits[r.URL.Path]++
+		s.mutex.Unlock()
+
+		links, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = fmt.Fprint(w, "<html><body>")
+		for _, link := range links {
+			_, _ = fmt.Fprintf(w, `<a href="%s">%s</a>`, link, link)
+		}
+		_, _ = fmt.Fprint(w, "</body></html>")
+	}))
+	return s
+}
+
+// hit returns the number of requests received for path
+func (s *siteServer) hit(path string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.hits[path]
+}
+
+// runCrawl crawls domain until it's done, and returns the results
+func runCrawl(domain string, conf *config, options ...Option) []*LinkMap {
+	syn := newSynchron(0, 1)
+	go func() {
+		crawl(domain, syn, conf, options...)
+		close(syn.results)
+	}()
+
+	var results []*LinkMap
+	for res := range syn.results {
+		results = append(results, res)
+	}
+	return results
+}
+
+// tempStateFile returns the path of a state file in a new temporary directory, and a function to remove it
+func tempStateFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "crawl-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "state.json"), func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// queued returns the links waiting to be visited by c, in order, emptying its queue
+func queued(c *crawler) []string {
+	var links []string
+	for len(c.todo) > 0 {
+		links = append(links, <-c.todo)
+	}
+	for link, ok := c.pop(); ok; link, ok = c.pop() {
+		links = append(links, link)
+	}
+	return links
+}
+
+// TestSaveRestoreState verifies the crawler's state is restored as it was saved
+func TestSaveRestoreState(t *testing.T) {
+	file, remove := tempStateFile(t)
+	defer remove()
+	domain := "https://example.com"
+	test := getTestData()
+
+	params := getTestParameters(time.Second)
+	WithState(file, 0)(params)
+	c, _ := newCrawler(domain, test.syn.results, params)
+	c.put(VisitedSet, domain, 1)
+	c.put(FailedSet, domain+"/failed", 1)
+	c.put(PendingSet, domain+"/retry", 2)
+	c.putPending(domain+"/in-flight", pendingLink{depth: 3, attempts: 1, visiting: true})
+
+	// More links than todo can hold
+	var todo []string
+	for i := 0; i < 2*cap(c.todo); i++ {
+		todo = append(todo, fmt.Sprintf("%s/%d", domain, i))
+	}
+	todo = append(todo, domain+"/retry")
+	for _, link := range todo {
+		c.enqueue(link)
+	}
+
+	if err := c.saveState(); err != nil {
+		t.Fatalf("saveState() should not fail : %s", err)
+	}
+
+	params = getTestParameters(time.Second)
+	WithState(file, 0)(params)
+	WithResume()(params)
+	r, _ := newCrawler(domain, test.syn.results, params)
+	if restored, err := r.restoreState(); !restored || err != nil {
+		t.Fatalf("restoreState() should restore the saved state : %s", err)
+	}
+
+	assert.Equal(t, c.list(VisitedSet), r.list(VisitedSet))
+	assert.Equal(t, c.list(FailedSet), r.list(FailedSet))
+	assert.Equal(t, pendingLink{depth: 0, attempts: 2, visiting: false}, r.pending(domain+"/retry"))
+	assert.Equal(t, pendingLink{depth: 3, attempts: 0, visiting: false}, r.pending(domain+"/in-flight"))
+	assert.Equal(t, len(todo)+1, r.count(PendingSet))
+	assert.Equal(t, append(todo, domain+"/in-flight"), queued(r))
+
+	// A state saved for another domain can't be resumed
+	other, _ := newCrawler("https://example.org", test.syn.results, params)
+	if _, err := other.restoreState(); err == nil {
+		t.Error("restoreState() should fail on a state saved for another domain.")
+	}
+
+	// No state to resume from
+	_ = os.Remove(file)
+	if restored, err := r.restoreState(); restored || err != nil {
+		t.Errorf("restoreState() should start from scratch without state file : %s", err)
+	}
+}
+
+// TestCrawlResume verifies an interrupted crawl continues where it stopped, and saves its state when done
+func TestCrawlResume(t *testing.T) {
+	site := newSiteServer(map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/c"},
+		"/b": {"/a"},
+		"/c": {"/"},
+	})
+	defer site.Close()
+	file, remove := tempStateFile(t)
+	defer remove()
+
+	saved := fmt.Sprintf(`{"domain": "%[1]s", "visited": ["%[1]s", "%[1]s/b"], "pending": {}, "todo": ["%[1]s/a"]}`,
+		site.URL)
+	if err := ioutil.WriteFile(file, []byte(saved), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := getTestConfig()
+	conf.State.File = file
+	conf.State.Resume = true
+	results := runCrawl(site.URL, conf)
+
+	var visited []string
+	for _, res := range results {
+		visited = append(visited, strings.TrimPrefix(res.URL, site.URL))
+	}
+	assert.ElementsMatch(t, []string{"/a", "/c"}, visited)
+	assert.Equal(t, 0, site.hit("/"))
+	assert.Equal(t, 0, site.hit("/b"))
+
+	state, err := loadState(file)
+	if err != nil {
+		t.Fatalf("the crawler should save its state on shutdown : %s", err)
+	}
+	assert.ElementsMatch(t, []string{site.URL, site.URL + "/a", site.URL + "/b", site.URL + "/c"}, state.Visited)
+	assert.Empty(t, state.Todo)
+	assert.Empty(t, state.Pending)
+}
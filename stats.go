@@ -0,0 +1,80 @@
+package crawl
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats is a snapshot of the progress of a crawl
+type Stats struct {
+	Visited        int         // links visited, including redirections and those of a resumed crawl
+	Failed         int         // links that could not be retrieved
+	Pending        int         // links waiting or being visited
+	Retries        int         // attempts made again after an error
+	Bytes          int64       // bytes of bodies received, before decoding
+	Start          time.Time   // when the crawl started
+	End            time.Time   // when the crawl ended, zero while it is running
+	PagesPerSecond float64     // pages retrieved per second, since Start
+	StatusCodes    map[int]int // number of pages retrieved by status code
+}
+
+// add counts a page that was retrieved or failed
+func (s *Stats) add(res *LinkMap) {
+	s.Bytes += res.TransferSize
+	if res.Error == nil {
+		s.StatusCodes[res.Status]++
+	}
+}
+
+// crawlStats holds the stats of a crawl, updated by the crawler and read by callers
+type crawlStats struct {
+	mutex sync.Mutex
+	stats Stats
+}
+
+func newCrawlStats() *crawlStats {
+	return &crawlStats{
+		mutex: sync.Mutex{},
+		stats: Stats{
+			Visited:        0,
+			Failed:         0,
+			Pending:        0,
+			Retries:        0,
+			Bytes:          0,
+			Start:          time.Time{},
+			End:            time.Time{},
+			PagesPerSecond: 0,
+			StatusCodes:    make(map[int]int),
+		},
+	}
+}
+
+// update calls f with the stats to modify
+func (c *crawlStats) update(f func(stats *Stats)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f(&c.stats)
+}
+
+// snapshot returns a copy of the stats, with the rate at which pages were retrieved until now or the end of the crawl
+func (c *crawlStats) snapshot() Stats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	s := c.stats
+	s.StatusCodes = make(map[int]int, len(c.stats.StatusCodes))
+	pages := 0
+	for code, n := range c.stats.StatusCodes {
+		s.StatusCodes[code] = n
+		pages += n
+	}
+
+	end := s.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if elapsed := end.Sub(s.Start).Seconds(); !s.Start.IsZero() && elapsed > 0 {
+		s.PagesPerSecond = float64(pages) / elapsed
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package crawl
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStatsSnapshot verifies snapshots are copies, with the rate pages were retrieved at
+func TestStatsSnapshot(t *testing.T) {
+	stats := newCrawlStats()
+	start := time.Now().Add(-10 * time.Second)
+	stats.update(func(s *Stats) {
+		s.Start, s.End = start, start.Add(2*time.Second)
+		s.add(&LinkMap{Status: 200, TransferSize: 100})
+		s.add(&LinkMap{Status: 200, TransferSize: 50})
+		s.add(&LinkMap{Status: 404, TransferSize: 10})
+		s.add(&LinkMap{Status: 500, TransferSize: 5, Error: errBodyTooLarge})
+	})
+
+	snapshot := stats.snapshot()
+	assert.Equal(t, map[int]int{200: 2, 404: 1}, snapshot.StatusCodes)
+	assert.Equal(t, int64(165), snapshot.Bytes)
+	assert.Equal(t, 1.5, snapshot.PagesPerSecond)
+
+	snapshot.StatusCodes[200] = 0
+	assert.Equal(t, 2, stats.snapshot().StatusCodes[200])
+
+	assert.Equal(t, 0.0, newCrawlStats().snapshot().PagesPerSecond)
+}
+
+// TestCrawlStats verifies the stats of a crawl are available while it runs, and once it is done
+func TestCrawlStats(t *testing.T) {
+	release := make(chan struct{})
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			_, _ = fmt.Fprint(w, `<a href="/slow">slow</a><a href="/missing">missing</a><a href="/broken">broken</a>`)
+		case "/slow":
+			<-release
+			_, _ = fmt.Fprint(w, `<title>slow</title>`)
+		case "/broken":
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	conf := getTestConfig()
+	syn := newSynchron(0, 1)
+	results := newCrawlerResults(syn)
+	go func() {
+		crawl(site.URL, syn, conf)
+		close(syn.results)
+	}()
+	done := make(chan struct{})
+	go func() {
+		for range syn.results {
+		}
+		close(done)
+	}()
+
+	// /slow is being visited until released, once the other pages are done
+	var live Stats
+	for live = results.Stats(); live.Visited+live.Failed < 3; live = results.Stats() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 1, live.Pending)
+	assert.True(t, live.End.IsZero())
+	close(release)
+
+	<-done
+	stats := results.Stats()
+	assert.Equal(t, 3, stats.Visited)
+	assert.Equal(t, 1, stats.Failed)
+	assert.Equal(t, 0, stats.Pending)
+	assert.Equal(t, int(conf.Requests.Retries)-1, stats.Retries)
+	assert.Equal(t, map[int]int{200: 2, 404: 1}, stats.StatusCodes)
+	assert.Equal(t, results.Bandwidth().Transferred, stats.Bytes)
+	assert.False(t, stats.End.Before(stats.Start))
+	assert.True(t, stats.PagesPerSecond > 0)
+}
@@ -0,0 +1,326 @@
+package crawl
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	storeMemory         = "memory"
+	storeBolt           = "bolt"
+	storeDefaultPattern = "crawl-state-*.db"
+	storeDefaultPerms   = 0600
+	storeOpenTimeout    = 5 * time.Second // to wait for another crawl to release the database
+)
+
+// LinkSet identifies the sets in which the crawler keeps track of links
+type LinkSet uint8
+
+const (
+	// VisitedSet holds links that were successfully scraped
+	VisitedSet LinkSet = iota
+
+	// PendingSet holds links waiting or being visited, with their depth and number of attempts
+	PendingSet
+
+	// FailedSet holds links that could not be scraped
+	FailedSet
+
+	// SeenSet holds every link discovered, whatever its state, when links are deduplicated exactly
+	SeenSet
+)
+
+// linkSets lists all link sets, e.g. to initialise a store
+var linkSets = []LinkSet{VisitedSet, PendingSet, FailedSet, SeenSet}
+
+// String returns the name of the set
+func (s LinkSet) String() string {
+	switch s {
+	case VisitedSet:
+		return "visited"
+	case PendingSet:
+		return "pending"
+	case FailedSet:
+		return "failed"
+	case SeenSet:
+		return "seen"
+	default:
+		return "unknown"
+	}
+}
+
+// StateStore holds the state of links during a crawl, as sets of links associated to a value, and the queue of links
+// waiting to be visited. The crawler only uses a store from a single goroutine, and closes it when it is done.
+type StateStore interface {
+	// Get returns the value associated to link in set, and whether the link is in the set
+	Get(set LinkSet, link string) (int, bool, error)
+
+	// Put adds link to set with the value, or updates its value
+	Put(set LinkSet, link string, value int) error
+
+	// Delete removes link from set. Removing a link that is not in the set is not an error.
+	Delete(set LinkSet, link string) error
+
+	// Len returns the number of links in set
+	Len(set LinkSet) (int, error)
+
+	// ForEach calls fn for every link in set, and stops on the first error
+	ForEach(set LinkSet, fn func(link string, value int) error) error
+
+	// Push appends link to the queue
+	Push(link string) error
+
+	// Pop removes the first link of the queue and returns it, and false if the queue is empty
+	Pop() (string, bool, error)
+
+	// ForEachQueued calls fn for every link of the queue, in order, and stops on the first error
+	ForEachQueued(fn func(link string) error) error
+
+	// Close releases the store's resources
+	Close() error
+}
+
+// memoryStore is a StateStore keeping links in memory
+type memoryStore struct {
+	sets  map[LinkSet]map[string]int
+	queue []string
+}
+
+// newMemoryStore returns an empty in-memory StateStore
+func newMemoryStore() *memoryStore {
+	m := &memoryStore{sets: make(map[LinkSet]map[string]int, len(linkSets)), queue: nil}
+	for _, set := range linkSets {
+		m.sets[set] = make(map[string]int)
+	}
+	return m
+}
+
+// Get implements StateStore
+func (m *memoryStore) Get(set LinkSet, link string) (int, bool, error) {
+	value, ok := m.sets[set][link]
+	return value, ok, nil
+}
+
+// Put implements StateStore
+func (m *memoryStore) Put(set LinkSet, link string, value int) error {
+	m.sets[set][link] = value
+	return nil
+}
+
+// Delete implements StateStore
+func (m *memoryStore) Delete(set LinkSet, link string) error {
+	delete(m.sets[set], link)
+	return nil
+}
+
+// Len implements StateStore
+func (m *memoryStore) Len(set LinkSet) (int, error) {
+	return len(m.sets[set]), nil
+}
+
+// ForEach implements StateStore
+func (m *memoryStore) ForEach(set LinkSet, fn func(link string, value int) error) error {
+	for link, value := range m.sets[set] {
+		if err := fn(link, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Push implements StateStore
+func (m *memoryStore) Push(link string) error {
+	m.queue = append(m.queue, link)
+	return nil
+}
+
+// Pop implements StateStore
+func (m *memoryStore) Pop() (string, bool, error) {
+	if len(m.queue) == 0 {
+		return "", false, nil
+	}
+	link := m.queue[0]
+	m.queue = m.queue[1:]
+	return link, true, nil
+}
+
+// ForEachQueued implements StateStore
+func (m *memoryStore) ForEachQueued(fn func(link string) error) error {
+	for _, link := range m.queue {
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements StateStore
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+// newStateStore returns the StateStore set by the configuration
+func newStateStore(conf *config) (StateStore, error) {
+	switch conf.State.Store {
+	case storeMemory, "":
+		return newMemoryStore(), nil
+	case storeBolt:
+		if conf.State.Path != "" {
+			return newBoltStore(conf.State.Path, storeDefaultPerms)
+		}
+
+		// Each crawl has its own database, removed once done
+		tmp, err := ioutil.TempFile("", storeDefaultPattern)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not create state store")
+		}
+		_ = tmp.Close()
+		store, err := newBoltStore(tmp.Name(), storeDefaultPerms)
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+			return nil, err
+		}
+		store.temporary = true
+		return store, nil
+	default:
+		return nil, errors.Errorf("Unknown state store '%s'", conf.State.Store)
+	}
+}
+
+// linkStates keeps track of the state of links in a StateStore. Store errors are logged, and the link is considered
+// absent, so that the crawl goes on.
+type linkStates struct {
+	store StateStore
+}
+
+// pendingLink is the state of a link waiting or being visited, kept as a single value in PendingSet
+type pendingLink struct {
+	depth    int  // number of links followed from the domain to reach the link
+	attempts int  // attempts at visiting the link, including the one in progress
+	visiting bool // the link is being visited
+}
+
+const (
+	pendingAttemptsBits = 16
+	pendingVisiting     = 1 << pendingAttemptsBits
+	pendingDepthShift   = pendingAttemptsBits + 1
+)
+
+// value returns the value of p in PendingSet
+func (p pendingLink) value() int {
+	value := p.depth<<pendingDepthShift | p.attempts
+	if p.visiting {
+		value |= pendingVisiting
+	}
+	return value
+}
+
+// newPendingLink returns the pending link of a value of PendingSet
+func newPendingLink(value int) pendingLink {
+	return pendingLink{
+		depth:    value >> pendingDepthShift,
+		attempts: value & (pendingVisiting - 1),
+		visiting: value&pendingVisiting != 0,
+	}
+}
+
+// logStoreError logs an error that happened on the store
+func logStoreError(err error, set LinkSet, link string) {
+	log.WithField("set", set.String()).Errorf("State store error on '%s' : %s", link, err)
+}
+
+// has returns whether link is in set
+func (l linkStates) has(set LinkSet, link string) bool {
+	_, ok, err := l.store.Get(set, link)
+	if err != nil {
+		logStoreError(err, set, link)
+	}
+	return ok
+}
+
+// get returns the value of link in set, 0 if absent
+func (l linkStates) get(set LinkSet, link string) int {
+	value, _, err := l.store.Get(set, link)
+	if err != nil {
+		logStoreError(err, set, link)
+	}
+	return value
+}
+
+// put adds link to set with value
+func (l linkStates) put(set LinkSet, link string, value int) {
+	if err := l.store.Put(set, link, value); err != nil {
+		logStoreError(err, set, link)
+	}
+}
+
+// remove removes link from set
+func (l linkStates) remove(set LinkSet, link string) {
+	if err := l.store.Delete(set, link); err != nil {
+		logStoreError(err, set, link)
+	}
+}
+
+// pending returns the state of link in PendingSet
+func (l linkStates) pending(link string) pendingLink {
+	return newPendingLink(l.get(PendingSet, link))
+}
+
+// putPending sets the state of link in PendingSet
+func (l linkStates) putPending(link string, p pendingLink) {
+	l.put(PendingSet, link, p.value())
+}
+
+// push appends link to the queue, and returns whether it is queued
+func (l linkStates) push(link string) bool {
+	if err := l.store.Push(link); err != nil {
+		logStoreError(err, PendingSet, link)
+		return false
+	}
+	return true
+}
+
+// pop removes the first link of the queue and returns it, and false if there is none
+func (l linkStates) pop() (string, bool) {
+	link, ok, err := l.store.Pop()
+	if err != nil {
+		logStoreError(err, PendingSet, link)
+	}
+	return link, ok
+}
+
+// count returns the number of links in set
+func (l linkStates) count(set LinkSet) int {
+	n, err := l.store.Len(set)
+	if err != nil {
+		logStoreError(err, set, "")
+	}
+	return n
+}
+
+// values returns the links of set with their values
+func (l linkStates) values(set LinkSet) map[string]int {
+	values := make(map[string]int)
+	if err := l.store.ForEach(set, func(link string, value int) error {
+		values[link] = value
+		return nil
+	}); err != nil {
+		logStoreError(errors.Wrap(err, "could not list links"), set, "")
+	}
+	return values
+}
+
+// list returns the links of set
+func (l linkStates) list(set LinkSet) []string {
+	links := make([]string, 0, l.count(set))
+	if err := l.store.ForEach(set, func(link string, _ int) error {
+		links = append(links, link)
+		return nil
+	}); err != nil {
+		logStoreError(errors.Wrap(err, "could not list links"), set, "")
+	}
+	return links
+}
@@ -0,0 +1,191 @@
+package crawl
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltStore is a StateStore keeping links on disk in a bbolt database, so that crawls are not limited by memory.
+// Writes are not synced to disk : the database is a working set, and checkpoints are kept in the state file.
+type boltStore struct {
+	db        *bolt.DB
+	mutex     sync.Mutex
+	counts    map[LinkSet]int // only updated once a change is committed
+	temporary bool            // the database file is removed on Close
+}
+
+// boltQueue is the bucket of the queue, whose keys are sequence numbers, and values links
+var boltQueue = []byte("queue")
+
+// newBoltStore returns a StateStore backed by a bbolt database at path. Links left from a previous crawl are removed.
+// Opening fails if another crawl still uses the database after storeOpenTimeout.
+func newBoltStore(path string, perms os.FileMode) (*boltStore, error) {
+	db, err := bolt.Open(path, perms, &bolt.Options{Timeout: storeOpenTimeout})
+	if err == bolt.ErrTimeout {
+		return nil, errors.Errorf("Could not open state store '%s' : it is used by another crawl", path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not open state store '%s'", path)
+	}
+	db.NoSync = true
+
+	b := &boltStore{db: db, mutex: sync.Mutex{}, counts: make(map[LinkSet]int, len(linkSets)), temporary: false}
+	err = db.Update(func(tx *bolt.Tx) error {
+		names := [][]byte{boltQueue}
+		for _, set := range linkSets {
+			names = append(names, []byte(set.String()))
+		}
+		for _, name := range names {
+			if tx.Bucket(name) != nil {
+				if err := tx.DeleteBucket(name); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrapf(err, "Could not initialise state store '%s'", path)
+	}
+
+	return b, nil
+}
+
+// encodeValue returns the binary representation of value
+func encodeValue(value int) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutVarint(buf, int64(value))]
+}
+
+// decodeValue returns the value of its binary representation
+func decodeValue(buf []byte) int {
+	value, _ := binary.Varint(buf)
+	return int(value)
+}
+
+// Get implements StateStore
+func (b *boltStore) Get(set LinkSet, link string) (value int, ok bool, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket([]byte(set.String())).Get([]byte(link)); v != nil {
+			value, ok = decodeValue(v), true
+		}
+		return nil
+	})
+	return value, ok, err
+}
+
+// Put implements StateStore
+func (b *boltStore) Put(set LinkSet, link string, value int) error {
+	added := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(set.String()))
+		key := []byte(link)
+		added = bucket.Get(key) == nil
+		return bucket.Put(key, encodeValue(value))
+	})
+	if err == nil && added {
+		b.count(set, 1)
+	}
+	return err
+}
+
+// Delete implements StateStore
+func (b *boltStore) Delete(set LinkSet, link string) error {
+	removed := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(set.String()))
+		key := []byte(link)
+		if bucket.Get(key) == nil {
+			return nil
+		}
+		removed = true
+		return bucket.Delete(key)
+	})
+	if err == nil && removed {
+		b.count(set, -1)
+	}
+	return err
+}
+
+// count adds n to the number of links in set
+func (b *boltStore) count(set LinkSet, n int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.counts[set] += n
+}
+
+// Len implements StateStore
+func (b *boltStore) Len(set LinkSet) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.counts[set], nil
+}
+
+// ForEach implements StateStore
+func (b *boltStore) ForEach(set LinkSet, fn func(link string, value int) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(set.String())).ForEach(func(k, v []byte) error {
+			return fn(string(k), decodeValue(v))
+		})
+	})
+}
+
+// Push implements StateStore
+func (b *boltStore) Push(link string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltQueue)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return bucket.Put(key, []byte(link))
+	})
+}
+
+// Pop implements StateStore
+func (b *boltStore) Pop() (link string, ok bool, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltQueue).Cursor()
+		key, value := cursor.First()
+		if key == nil {
+			return nil
+		}
+		link, ok = string(value), true
+		return cursor.Delete()
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return link, ok, nil
+}
+
+// ForEachQueued implements StateStore
+func (b *boltStore) ForEachQueued(fn func(link string) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltQueue).ForEach(func(_, v []byte) error {
+			return fn(string(v))
+		})
+	})
+}
+
+// Close implements StateStore
+func (b *boltStore) Close() error {
+	path := b.db.Path()
+	err := b.db.Close()
+	if b.temporary {
+		if rerr := os.Remove(path); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,195 @@
+package crawl
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// testStateStore verifies the behaviour common to all StateStore implementations
+func testStateStore(t *testing.T, store StateStore) {
+	link := "https://example.com/a"
+
+	if _, ok, err := store.Get(PendingSet, link); ok || err != nil {
+		t.Errorf("Get() on an empty store should not find a link : %v", err)
+	}
+
+	assert.NoError(t, store.Put(PendingSet, link, 1))
+	assert.NoError(t, store.Put(PendingSet, link, 2))
+	assert.NoError(t, store.Put(PendingSet, "https://example.com/b", -1))
+	assert.NoError(t, store.Put(VisitedSet, link, 1))
+
+	value, ok, err := store.Get(PendingSet, link)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, value)
+
+	n, err := store.Len(PendingSet)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// Sets are independent
+	if _, ok, _ := store.Get(FailedSet, link); ok {
+		t.Error("a link should only be found in the sets it was put in")
+	}
+
+	values := make(map[string]int)
+	assert.NoError(t, store.ForEach(PendingSet, func(link string, value int) error {
+		values[link] = value
+		return nil
+	}))
+	assert.Equal(t, map[string]int{link: 2, "https://example.com/b": -1}, values)
+
+	// ForEach stops on error
+	stop := errors.New("stop")
+	calls := 0
+	assert.Equal(t, stop, errors.Cause(store.ForEach(PendingSet, func(string, int) error {
+		calls++
+		return stop
+	})))
+	assert.Equal(t, 1, calls)
+
+	assert.NoError(t, store.Delete(PendingSet, link))
+	assert.NoError(t, store.Delete(PendingSet, link))
+	if _, ok, _ := store.Get(PendingSet, link); ok {
+		t.Error("Delete() should remove the link")
+	}
+	n, _ = store.Len(PendingSet)
+	assert.Equal(t, 1, n)
+	n, _ = store.Len(VisitedSet)
+	assert.Equal(t, 1, n)
+
+	// The queue keeps links in order
+	for _, link := range []string{"https://example.com/c", "https://example.com/a", "https://example.com/b"} {
+		assert.NoError(t, store.Push(link))
+	}
+	first, ok, err := store.Pop()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "https://example.com/c", first)
+	assert.NoError(t, store.Push("https://example.com/c"))
+	var queue []string
+	assert.NoError(t, store.ForEachQueued(func(link string) error {
+		queue = append(queue, link)
+		return nil
+	}))
+	assert.Equal(t, []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}, queue)
+	for range queue {
+		_, _, _ = store.Pop()
+	}
+	if _, ok, err := store.Pop(); ok || err != nil {
+		t.Errorf("Pop() on an empty queue should not return a link : %v", err)
+	}
+
+	assert.NoError(t, store.Close())
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStateStore(t, newMemoryStore())
+}
+
+func TestBoltStore(t *testing.T) {
+	dir, remove := tempStateFile(t)
+	defer remove()
+	path := filepath.Join(filepath.Dir(dir), "state.db")
+
+	store, err := newBoltStore(path, storeDefaultPerms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStateStore(t, store)
+
+	// A previous crawl's links are not kept
+	store, err = newBoltStore(path, storeDefaultPerms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+	n, _ := store.Len(VisitedSet)
+	assert.Equal(t, 0, n)
+
+	// Counts only change once changes are committed
+	assert.NoError(t, store.Put(VisitedSet, "https://example.com/a", 1))
+	assert.Error(t, store.Put(VisitedSet, "", 1))
+	_ = store.db.Close()
+	assert.Error(t, store.Put(VisitedSet, "https://example.com/b", 1))
+	assert.Error(t, store.Delete(VisitedSet, "https://example.com/a"))
+	n, _ = store.Len(VisitedSet)
+	assert.Equal(t, 1, n)
+}
+
+func TestNewStateStore(t *testing.T) {
+	file, remove := tempStateFile(t)
+	defer remove()
+
+	conf := getTestConfig()
+	conf.State.Store = storeMemory
+	store, err := newStateStore(conf)
+	assert.NoError(t, err)
+	assert.IsType(t, &memoryStore{}, store)
+
+	conf.State.Store = storeBolt
+	conf.State.Path = file
+	store, err = newStateStore(conf)
+	assert.NoError(t, err)
+	assert.IsType(t, &boltStore{}, store)
+	_ = store.Close()
+
+	// Without a path, each crawl has its own database, removed when done
+	conf.State.Path = ""
+	first, err := newStateStore(conf)
+	assert.NoError(t, err)
+	second, err := newStateStore(conf)
+	assert.NoError(t, err)
+	path := first.(*boltStore).db.Path()
+	assert.NotEqual(t, path, second.(*boltStore).db.Path())
+	assert.NoError(t, first.Close())
+	assert.NoError(t, second.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	conf.State.Store = "unknown"
+	if _, err := newStateStore(conf); err == nil {
+		t.Error("newStateStore() should fail on an unknown store")
+	}
+}
+
+// TestCrawlBoltStore verifies a crawl is the same whether links are kept in memory or on disk
+func TestCrawlBoltStore(t *testing.T) {
+	site := newSiteServer(map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/c", "/missing"},
+		"/b": {"/a"},
+		"/c": {"/"},
+	})
+	defer site.Close()
+	file, remove := tempStateFile(t)
+	defer remove()
+
+	crawled := func(results []*LinkMap) []string {
+		var urls []string
+		for _, res := range results {
+			urls = append(urls, strings.TrimPrefix(res.URL, site.URL))
+		}
+		sort.Strings(urls)
+		return urls
+	}
+
+	conf := getTestConfig()
+	conf.Requests.Retries = 1
+	inMemory := crawled(runCrawl(site.URL, conf))
+
+	conf.State.Store = storeBolt
+	conf.State.Path = file
+	onDisk := crawled(runCrawl(site.URL, conf))
+
+	assert.Equal(t, []string{"", "/a", "/b", "/c", "/missing"}, inMemory)
+	assert.Equal(t, inMemory, onDisk)
+}
@@ -14,6 +14,10 @@ type synchron struct {
 	group       sync.WaitGroup
 	stopFlag    bool
 	exitContext string
+	duplicates  []DuplicateCluster // set by the crawler before it returns
+	canonicals  []CanonicalIssue   // set by the crawler before it returns
+	bandwidth   Bandwidth          // set by the crawler before it returns
+	stats       *crawlStats        // updated by the crawler as it goes
 }
 
 // newSynchron returns an initialised synchron struct
@@ -25,6 +29,7 @@ func newSynchron(timeout time.Duration, nbParties int) *synchron {
 		stopChan: make(chan struct{}, 2),
 		stopFlag: false,
 		mutex:    &sync.Mutex{},
+		stats:    newCrawlStats(),
 	}
 
 	s.group.Add(nbParties)
@@ -0,0 +1,282 @@
+package crawl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1" // nolint:gosec // SHA-1 is what WARC digests use, not a security measure
+	"encoding/base32"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	warcVersion        = "WARC/1.0"
+	warcDefaultPrefix  = "crawl"
+	warcDefaultMaxSize = 1 << 30
+	warcFilePerms      = 0644
+)
+
+// warcRedactedHeaders are the request headers whose values are not archived, as they hold credentials
+var warcRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// warcRecord is a WARC record, before it's written
+type warcRecord struct {
+	header http.Header
+	block  []byte
+}
+
+// warcWriter writes WARC records, each one compressed as a gzip member, to files in a directory. A file is closed and
+// another started once it's larger than maxSize. It's safe for concurrent use.
+type warcWriter struct {
+	mutex   sync.Mutex
+	dir     string
+	prefix  string
+	maxSize int64
+	file    *os.File
+	size    int64
+	serial  int
+}
+
+// newWARCWriter returns a warcWriter writing files named after prefix in dir. The directory is created if need be.
+func newWARCWriter(dir, prefix string, maxSize int64) (*warcWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "Could not create WARC directory '%s'", dir)
+	}
+	if prefix == "" {
+		prefix = warcDefaultPrefix
+	}
+	if maxSize <= 0 {
+		maxSize = warcDefaultMaxSize
+	}
+
+	return &warcWriter{
+		mutex:   sync.Mutex{},
+		dir:     dir,
+		prefix:  prefix,
+		maxSize: maxSize,
+		file:    nil,
+		size:    0,
+		serial:  0,
+	}, nil
+}
+
+// newRecordID returns a new WARC record identifier, as a random UUID
+func newRecordID() string {
+	var u [16]byte
+	_, _ = rand.Read(u[:])
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// warcDigest returns the WARC digest of data
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data) // nolint:gosec // see import
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// newWARCRecord returns a record of type with the block, dated date
+func newWARCRecord(typ string, date time.Time, contentType string, block []byte) *warcRecord {
+	header := http.Header{}
+	header.Set("WARC-Type", typ)
+	header.Set("WARC-Record-ID", newRecordID())
+	header.Set("WARC-Date", date.UTC().Format(time.RFC3339))
+	header.Set("Content-Type", contentType)
+	header.Set("WARC-Block-Digest", warcDigest(block))
+	return &warcRecord{header: header, block: block}
+}
+
+// encode returns the record, compressed as a gzip member
+func (r *warcRecord) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+
+	// Headers are written in a stable order, the version line first
+	_, _ = fmt.Fprintf(gz, "%s\r\n", warcVersion)
+	for _, name := range []string{"WARC-Type", "WARC-Record-ID", "WARC-Date", "WARC-Target-URI",
+		"WARC-Concurrent-To", "WARC-Refers-To", "WARC-Filename", "Content-Type", "WARC-Block-Digest",
+		"WARC-Payload-Digest"} {
+		if value := r.header.Get(name); value != "" {
+			_, _ = fmt.Fprintf(gz, "%s: %s\r\n", name, value)
+		}
+	}
+	_, _ = fmt.Fprintf(gz, "Content-Length: %d\r\n\r\n", len(r.block))
+	_, _ = gz.Write(r.block)
+	_, _ = gz.Write([]byte("\r\n\r\n"))
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// rotate closes the current file, and starts a new one beginning with a warcinfo record. It must be called with the
+// mutex held.
+func (w *warcWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return errors.Wrap(err, "Could not close WARC file")
+		}
+	}
+
+	w.serial++
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", w.prefix, time.Now().UTC().Format("20060102150405"), w.serial)
+	file, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, warcFilePerms)
+	if err != nil {
+		return errors.Wrap(err, "Could not create WARC file")
+	}
+	w.file, w.size = file, 0
+
+	info := newWARCRecord("warcinfo", time.Now(), "application/warc-fields",
+		[]byte(fmt.Sprintf("software: %s\r\nformat: WARC File Format 1.0\r\n", defaultUserAgent)))
+	info.header.Set("WARC-Filename", name)
+	return w.writeRecord(info)
+}
+
+// writeRecord appends the record to the current file. It must be called with the mutex held.
+func (w *warcWriter) writeRecord(r *warcRecord) error {
+	data, err := r.encode()
+	if err != nil {
+		return errors.Wrap(err, "Could not compress WARC record")
+	}
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	return errors.Wrap(err, "Could not write WARC record")
+}
+
+// write appends the records to the current file, after starting a new file if it's full, so that records of a same
+// exchange are kept together
+func (w *warcWriter) write(records ...*warcRecord) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil || w.size >= w.maxSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range records {
+		if err := w.writeRecord(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeExchange writes the request, response and metadata records of an HTTP exchange, with the response body
+// already read
+func (w *warcWriter) writeExchange(req *http.Request, resp *http.Response, body []byte, date time.Time,
+	duration time.Duration) error {
+	uri := req.URL.String()
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	// Credentials are not archived
+	header := req.Header.Clone()
+	for _, name := range warcRedactedHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, "[redacted]")
+		}
+	}
+
+	var reqBlock bytes.Buffer
+	_, _ = fmt.Fprintf(&reqBlock, "%s %s HTTP/1.1\r\nHost: %s\r\n", req.Method, req.URL.RequestURI(), host)
+	_ = header.Write(&reqBlock)
+	_, _ = reqBlock.WriteString("\r\n")
+
+	var respBlock bytes.Buffer
+	_, _ = fmt.Fprintf(&respBlock, "%s %s\r\n", resp.Proto, resp.Status)
+	_ = resp.Header.Write(&respBlock)
+	_, _ = respBlock.WriteString("\r\n")
+	_, _ = respBlock.Write(body)
+
+	response := newWARCRecord("response", date, "application/http;msgtype=response", respBlock.Bytes())
+	response.header.Set("WARC-Target-URI", uri)
+	response.header.Set("WARC-Payload-Digest", warcDigest(body))
+	responseID := response.header.Get("WARC-Record-ID")
+
+	request := newWARCRecord("request", date, "application/http;msgtype=request", reqBlock.Bytes())
+	request.header.Set("WARC-Target-URI", uri)
+	request.header.Set("WARC-Concurrent-To", responseID)
+
+	metadata := newWARCRecord("metadata", date, "application/warc-fields",
+		[]byte(fmt.Sprintf("fetchTimeMs: %d\r\n", duration.Milliseconds())))
+	metadata.header.Set("WARC-Target-URI", uri)
+	metadata.header.Set("WARC-Refers-To", responseID)
+
+	return w.write(request, response, metadata)
+}
+
+// Close closes the current file
+func (w *warcWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// warcTransport is an http.RoundTripper archiving every exchange, including redirections, in WARC files
+type warcTransport struct {
+	base    http.RoundTripper
+	writer  *warcWriter
+	maxSize int64 // of bodies, as received, 0 for no limit
+}
+
+// RoundTrip implements http.RoundTripper. The response body is read to be archived, and given back to the caller
+// from memory. Bodies larger than maxSize are neither archived nor given back.
+func (t *warcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader = resp.Body
+	if t.maxSize > 0 {
+		reader = io.LimitReader(resp.Body, t.maxSize+1)
+	}
+	body, err := ioutil.ReadAll(reader)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if t.maxSize > 0 && int64(len(body)) > t.maxSize {
+		return nil, errBodyTooLarge
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err := t.writer.writeExchange(req, resp, body, start, time.Since(start)); err != nil {
+		log.WithField("url", req.URL.String()).Errorf("Could not archive exchange : %s", err)
+	}
+
+	return resp, nil
+}
+
+// withWARC returns a copy of client archiving its exchanges with writer, with bodies of at most maxSize bytes
+func withWARC(client *http.Client, writer *warcWriter, maxSize int64) *http.Client {
+	c := *client
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = &warcTransport{base: base, writer: writer, maxSize: maxSize}
+	return &c
+}
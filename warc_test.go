@@ -0,0 +1,185 @@
+package crawl
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readWARCFile returns the records of a gzipped WARC file, checking their structure
+func readWARCFile(t *testing.T, file string) []*warcRecord {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	// Each record is a gzip member, read as a single stream
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(gz)
+
+	var records []*warcRecord
+	for {
+		version, err := r.ReadString('\n')
+		if err == io.EOF {
+			return records
+		}
+		assert.Equal(t, warcVersion+"\r\n", version)
+
+		record := &warcRecord{header: http.Header{}}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\r\n" {
+				break
+			}
+			kv := strings.SplitN(strings.TrimSuffix(line, "\r\n"), ": ", 2)
+			record.header.Set(kv[0], kv[1])
+		}
+
+		length, err := strconv.Atoi(record.header.Get("Content-Length"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		record.block = make([]byte, length+4)
+		if _, err := io.ReadFull(r, record.block); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "\r\n\r\n", string(record.block[length:]))
+		record.block = record.block[:length]
+		assert.Equal(t, warcDigest(record.block), record.header.Get("WARC-Block-Digest"))
+
+		records = append(records, record)
+	}
+}
+
+// warcFiles returns the WARC files in dir
+func warcFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// TestCrawlWARC verifies every exchange of a crawl is archived, without credentials
+func TestCrawlWARC(t *testing.T) {
+	site := newSiteServer(map[string][]string{
+		"/":  {"/a"},
+		"/a": {},
+	})
+	defer site.Close()
+	file, remove := tempStateFile(t)
+	defer remove()
+	dir := filepath.Join(filepath.Dir(file), "warc")
+
+	results := runCrawl(site.URL, getTestConfig(), WithWARC(dir, 0), WithBearerToken("secret"))
+	assert.Len(t, results, 2)
+
+	files := warcFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("expected a single WARC file, got %v", files)
+	}
+	records := readWARCFile(t, files[0])
+
+	var types []string
+	for _, r := range records {
+		types = append(types, r.header.Get("WARC-Type"))
+	}
+	assert.Equal(t, []string{"warcinfo", "request", "response", "metadata", "request", "response", "metadata"},
+		types)
+
+	for i := 1; i < len(records); i += 3 {
+		request, response, metadata := records[i], records[i+1], records[i+2]
+		id := response.header.Get("WARC-Record-ID")
+		assert.Equal(t, id, request.header.Get("WARC-Concurrent-To"))
+		assert.Equal(t, id, metadata.header.Get("WARC-Refers-To"))
+		assert.Equal(t, request.header.Get("WARC-Target-URI"), response.header.Get("WARC-Target-URI"))
+
+		assert.True(t, strings.HasPrefix(string(request.block), "GET /"))
+		assert.NotContains(t, string(request.block), "secret")
+		assert.Contains(t, string(request.block), "Authorization: [redacted]")
+		assert.True(t, strings.HasPrefix(string(response.block), "HTTP/1.1 200 OK\r\n"))
+		assert.Contains(t, string(response.block), "<html><body>")
+	}
+}
+
+// TestWARCRotation verifies a new file is started when one is full, each with a warcinfo record
+func TestWARCRotation(t *testing.T) {
+	site := newSiteServer(map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {},
+		"/b": {},
+	})
+	defer site.Close()
+	file, remove := tempStateFile(t)
+	defer remove()
+	dir := filepath.Join(filepath.Dir(file), "warc")
+
+	runCrawl(site.URL, getTestConfig(), WithWARC(dir, 1))
+
+	files := warcFiles(t, dir)
+	assert.Len(t, files, 3)
+	for _, f := range files {
+		records := readWARCFile(t, f)
+		assert.Len(t, records, 4)
+		assert.Equal(t, "warcinfo", records[0].header.Get("WARC-Type"))
+		assert.Equal(t, filepath.Base(f), records[0].header.Get("WARC-Filename"))
+	}
+}
+
+// TestWARCBodyLimit verifies endless bodies are not buffered to be archived, and are not retried
+func TestWARCBodyLimit(t *testing.T) {
+	hits := 0
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path != "/endless" {
+			_, _ = fmt.Fprint(w, `<a href="/endless">endless</a>`)
+			return
+		}
+		hits++
+		chunk := make([]byte, 32<<10)
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+	defer site.Close()
+	file, remove := tempStateFile(t)
+	defer remove()
+	dir := filepath.Join(filepath.Dir(file), "warc")
+
+	results := runCrawl(site.URL, getTestConfig(), WithWARC(dir, 0), WithBodyLimits(1<<20, 0))
+	assert.Len(t, results, 2)
+	for _, res := range results {
+		if res.URL == site.URL+"/endless" {
+			assert.True(t, isBodyError(res.Error), res.Error)
+		}
+	}
+	assert.Equal(t, 1, hits)
+
+	// Only the exchange of the first page is archived
+	files := warcFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("expected a single WARC file, got %v", files)
+	}
+	assert.Len(t, readWARCFile(t, files[0]), 4)
+}